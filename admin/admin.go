@@ -0,0 +1,393 @@
+// Package admin provides JSON HTTP API over the limiter store, to inspect &
+// reset counters and to set time-bounded overrides of the request limits.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	goratelimit "github.com/alter123/go-ratelimit"
+	"github.com/alter123/go-ratelimit/libstring"
+	"github.com/alter123/go-ratelimit/limiter"
+	libredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// Handler serves the admin API, paths are relative to the mount point:
+//
+//	GET    /keys?prefix=203.0.113.7&limit=100    keys by prefix with count & ttl, see ScanKeys
+//	DELETE /keys?key=...|prefix=...               resets keys, by exact key or prefix
+//	GET    /counters?path=/login&remote_addr=...  counters of every tier of described request
+//	DELETE /counters?path=/login&remote_addr=...  resets counters of described request
+//	GET    /overrides?policy=login                overrides which are not expired
+//	POST   /overrides                             sets override, see OverrideRequest
+//	DELETE /overrides?policy=login&identity=...   revokes override
+//
+// Requests to counters are described as on goratelimit.ExplainHandler.
+type Handler struct {
+	// Authorize is invoked before every request, error rejects the request.
+	// It's required, all the requests are rejected otherwise.
+	Authorize func(r *http.Request) error
+
+	// Match resolves limiter of the described request, e.g. via config.Router
+	Match func(r *http.Request) *limiter.Limiter
+
+	// Overrides managed via the API, to be set on the limiters as well
+	Overrides limiter.OverrideStore
+}
+
+// Key of the store along with the counter
+type Key struct {
+	// Key without the store prefix
+	Key       string     `json:"key"`
+	Count     int64      `json:"count"`
+	TTL       string     `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// OverrideRequest sets override of the identity, either until expires_at or for ttl.
+// Limits are either limit per period or multiplier of the request limits.
+type OverrideRequest struct {
+	Policy     string    `json:"policy"`
+	Identity   string    `json:"identity"`
+	Limit      int64     `json:"limit,omitempty"`
+	Period     string    `json:"period,omitempty"`
+	Multiplier float64   `json:"multiplier,omitempty"`
+	TTL        string    `json:"ttl,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize == nil {
+		writeError(w, http.StatusForbidden, errors.New("authorization is not configured"))
+		return
+	}
+	if err := h.Authorize(r); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	switch route := strings.TrimSuffix(r.URL.Path, "/"); {
+	case route == "/keys" && r.Method == http.MethodGet:
+		h.listKeys(w, r)
+	case route == "/keys" && r.Method == http.MethodDelete:
+		h.resetKeys(w, r)
+	case route == "/counters" && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		h.counters(w, r)
+	case route == "/overrides" && r.Method == http.MethodGet:
+		h.listOverrides(w, r)
+	case route == "/overrides" && r.Method == http.MethodPost:
+		h.setOverride(w, r)
+	case route == "/overrides" && r.Method == http.MethodDelete:
+		h.deleteOverride(w, r)
+	case route == "/keys" || route == "/counters" || route == "/overrides":
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) listKeys(w http.ResponseWriter, r *http.Request) {
+	client := limiter.GetStoreClient()
+	if client == nil {
+		writeError(w, http.StatusServiceUnavailable, limiter.ErrNotInitialised)
+		return
+	}
+
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+		limit = n
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	keys, err := ScanKeys(r.Context(), client, limiter.GetStorePrefix(), r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func (h *Handler) resetKeys(w http.ResponseWriter, r *http.Request) {
+	client := limiter.GetStoreClient()
+	if client == nil {
+		writeError(w, http.StatusServiceUnavailable, limiter.ErrNotInitialised)
+		return
+	}
+
+	keys := r.URL.Query()["key"]
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+		scanned, err := ScanKeys(r.Context(), client, limiter.GetStorePrefix(), prefix, 0)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		for _, k := range scanned {
+			keys = append(keys, k.Key)
+		}
+	} else if len(keys) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("either key or prefix is required"))
+		return
+	}
+
+	deleted, err := DeleteKeys(r.Context(), client, limiter.GetStorePrefix(), keys...)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted})
+}
+
+func (h *Handler) counters(w http.ResponseWriter, r *http.Request) {
+	if h.Match == nil {
+		writeError(w, http.StatusNotFound, errors.New("limiter matcher is not configured"))
+		return
+	}
+
+	described, err := goratelimit.NewRequestFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	lmt := h.Match(described)
+	if lmt == nil {
+		writeError(w, http.StatusNotFound, errors.New("no limiter applies to the request"))
+		return
+	}
+
+	e, err := goratelimit.Explain(lmt, described)
+	if err != nil {
+		writeError(w, storeStatus(err), err)
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, e)
+		return
+	}
+
+	keys := make([]string, 0, len(e.Tiers))
+	for _, t := range e.Tiers {
+		if t.Key != "" {
+			keys = append(keys, t.Key)
+		}
+	}
+	deleted, err := DeleteKeys(r.Context(), limiter.GetStoreClient(), limiter.GetStorePrefix(), keys...)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted, "keys": keys})
+}
+
+func (h *Handler) listOverrides(w http.ResponseWriter, r *http.Request) {
+	if h.Overrides == nil {
+		writeError(w, http.StatusNotFound, errors.New("overrides are not configured"))
+		return
+	}
+
+	overrides, err := h.Overrides.List(r.Context(), r.URL.Query().Get("policy"))
+	if err != nil {
+		writeError(w, storeStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"overrides": overrides})
+}
+
+func (h *Handler) setOverride(w http.ResponseWriter, r *http.Request) {
+	if h.Overrides == nil {
+		writeError(w, http.StatusNotFound, errors.New("overrides are not configured"))
+		return
+	}
+
+	var req OverrideRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	o, err := req.Override(time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = h.Overrides.Set(r.Context(), o); err != nil {
+		writeError(w, storeStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, o)
+}
+
+func (h *Handler) deleteOverride(w http.ResponseWriter, r *http.Request) {
+	if h.Overrides == nil {
+		writeError(w, http.StatusNotFound, errors.New("overrides are not configured"))
+		return
+	}
+
+	identity := r.URL.Query().Get("identity")
+	if identity == "" {
+		writeError(w, http.StatusBadRequest, errors.New("identity is required"))
+		return
+	}
+	if err := h.Overrides.Delete(r.Context(), r.URL.Query().Get("policy"), identity); err != nil {
+		writeError(w, storeStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Override validates the request & returns the override it sets
+func (req OverrideRequest) Override(now time.Time) (limiter.Override, error) {
+	o := limiter.Override{Policy: req.Policy, Identity: req.Identity, Limit: req.Limit,
+		Multiplier: req.Multiplier, ExpiresAt: req.ExpiresAt}
+
+	if req.Period != "" {
+		period, err := time.ParseDuration(req.Period)
+		if err != nil {
+			return o, errors.New("period must be a duration, e.g. 1m")
+		}
+		o.Period = period
+	}
+
+	switch {
+	case req.TTL != "" && !req.ExpiresAt.IsZero():
+		return o, errors.New("either ttl or expires_at is to be set")
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return o, errors.New("ttl must be a positive duration, e.g. 2h")
+		}
+		o.ExpiresAt = now.Add(ttl)
+	case req.ExpiresAt.IsZero():
+		return o, errors.New("either ttl or expires_at is required")
+	case o.Expired(now):
+		return o, errors.New("expires_at must be in the future")
+	}
+	return o, o.Validate()
+}
+
+// ScanKeys returns keys of the store matching prefix along with the counters,
+// upto limit keys, all of them if limit is 0. Keys are returned without store prefix.
+// Prefix matches the key itself & keys of its dimensions, i.e. prefix followed by
+// KeyJoinIdentifier: 203.0.113.7 matches 203.0.113.7|/login but not 203.0.113.70.
+func ScanKeys(ctx context.Context, client *libredis.Client, storePrefix, prefix string, limit int) ([]Key, error) {
+	match := libstring.EscapePattern(storePrefix+":"+prefix) + "*"
+
+	var names []string
+	// Scan may return a key more than once
+	seen := map[string]bool{}
+	iter := client.Scan(ctx, 0, match, 100).Iterator()
+	for iter.Next(ctx) {
+		if seen[iter.Val()] || !matchesPrefix(strings.TrimPrefix(iter.Val(), storePrefix+":"), prefix) {
+			continue
+		}
+		seen[iter.Val()] = true
+		names = append(names, iter.Val())
+		if limit > 0 && len(names) >= limit {
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, storePrefix+":")
+	}
+	return GetKeys(ctx, client, storePrefix, names...)
+}
+
+// matchesPrefix validates if key is the prefix or one of its dimensions,
+// prefix may be passed along with trailing KeyJoinIdentifier
+func matchesPrefix(key, prefix string) bool {
+	return prefix == "" || key == prefix ||
+		strings.HasPrefix(key, strings.TrimSuffix(prefix, limiter.KeyJoinIdentifier)+limiter.KeyJoinIdentifier)
+}
+
+// GetKeys returns counters of the keys, keys are passed without store prefix.
+// Keys which don't exist are reported with zero count.
+func GetKeys(ctx context.Context, client *libredis.Client, storePrefix string, keys ...string) ([]Key, error) {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = storePrefix + ":" + k
+	}
+
+	pipe := client.Pipeline()
+	counts := make([]*libredis.StringCmd, len(names))
+	ttls := make([]*libredis.DurationCmd, len(names))
+	for i, name := range names {
+		counts[i] = pipe.Get(ctx, name)
+		ttls[i] = pipe.PTTL(ctx, name)
+	}
+	if len(names) > 0 {
+		// Keys expired in between are reported with zero count
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, libredis.Nil) {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	counters := make([]Key, len(keys))
+	for i, k := range keys {
+		counters[i] = Key{Key: k}
+		counters[i].Count, _ = counts[i].Int64()
+		if ttl := ttls[i].Val(); ttl > 0 {
+			expiresAt := now.Add(ttl)
+			counters[i].TTL, counters[i].ExpiresAt = ttl.String(), &expiresAt
+		}
+	}
+	return counters, nil
+}
+
+// DeleteKeys deletes keys of the store, keys are passed without store prefix
+func DeleteKeys(ctx context.Context, client *libredis.Client, storePrefix string, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if client == nil {
+		return 0, limiter.ErrNotInitialised
+	}
+
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = storePrefix + ":" + k
+	}
+	return client.Del(ctx, names...).Result()
+}
+
+func storeStatus(err error) int {
+	if errors.Is(err, limiter.ErrInvalidConfig) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, limiter.ErrStoreUnavailable) || errors.Is(err, limiter.ErrNotInitialised) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
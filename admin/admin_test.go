@@ -0,0 +1,125 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	mockredis "github.com/alicebob/miniredis/v2"
+	goratelimit "github.com/alter123/go-ratelimit"
+	"github.com/alter123/go-ratelimit/admin"
+	"github.com/alter123/go-ratelimit/limiter"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMain(m *testing.M) {
+	s, err := mockredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	goratelimit.Init(limiter.LimiterOptions{
+		Redis:  &redis.Options{Addr: s.Addr()},
+		Prefix: "tbrl",
+	})
+	os.Exit(m.Run())
+}
+
+func newRequest(t *testing.T, ip string) *http.Request {
+	r, err := http.NewRequest("GET", "/admin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("CF-Connecting-IP", ip)
+	return r
+}
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCounters(t *testing.T) {
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false)
+	h := &admin.Handler{
+		Authorize: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer admin" {
+				return errors.New("forbidden")
+			}
+			return nil
+		},
+		Match: func(_ *http.Request) *limiter.Limiter { return lmt },
+	}
+
+	if _, err := goratelimit.LimitByRequest(lmt, newRequest(t, "203.0.113.30")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/keys", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Unauthorized request is served: %d", w.Code)
+	}
+
+	w = serve(h, "GET", "/keys?prefix=203.0.113.30", "")
+	var listed struct{ Keys []admin.Key }
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	// Global & request keys
+	if w.Code != http.StatusOK || len(listed.Keys) != 2 || listed.Keys[0].Count != 1 || listed.Keys[0].TTL == "" {
+		t.Fatalf("Keys are not listed: %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve(h, "DELETE", "/counters?path=/admin&header=CF-Connecting-IP:+203.0.113.30", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":2`) {
+		t.Fatalf("Counters are not reset: %d %s", w.Code, w.Body.String())
+	}
+
+	if lmtCtx, err := goratelimit.LimitByRequest(lmt, newRequest(t, "203.0.113.30")); err != nil || lmtCtx.Reached {
+		t.Fatalf("Reset counters are still limited: %+v, %v", lmtCtx, err)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	overrides := limiter.NewMemoryOverrideStore()
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).SetOverrides(overrides)
+	h := &admin.Handler{
+		Authorize: func(_ *http.Request) error { return nil },
+		Overrides: overrides,
+	}
+
+	w := serve(h, "POST", "/overrides", `{"identity": "203.0.113.31", "limit": 5, "period": "1m"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Override without expiry is set: %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve(h, "POST", "/overrides", `{"identity": "203.0.113.31", "limit": 5, "period": "1m", "ttl": "1h"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Override is not set: %d %s", w.Code, w.Body.String())
+	}
+
+	for i := 0; i < 3; i++ {
+		lmtCtx, err := goratelimit.LimitByRequest(lmt, newRequest(t, "203.0.113.31"))
+		if err != nil || lmtCtx.Reached || lmtCtx.Tier != limiter.TierOverride || lmtCtx.Limit != 5 {
+			t.Fatalf("Override is not applied: %+v, %v", lmtCtx, err)
+		}
+	}
+
+	w = serve(h, "DELETE", "/overrides?identity=203.0.113.31", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Override is not revoked: %d %s", w.Code, w.Body.String())
+	}
+	if w = serve(h, "GET", "/overrides", ""); !strings.Contains(w.Body.String(), `"overrides":[]`) {
+		t.Fatalf("Revoked override is listed: %s", w.Body.String())
+	}
+}
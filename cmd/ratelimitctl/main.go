@@ -0,0 +1,420 @@
+// Command ratelimitctl inspects & manages limiter state on the redis store,
+// for use during incidents. Keys are passed & printed without the store prefix.
+//
+//	ratelimitctl [-addr localhost:6379] [-password ...] [-db 0] [-prefix tbrl] [-template ip|route] <command> [flags] [args]
+//
+// Keys are decoded into dimensions named after the key template of the limiter,
+// ip, path, method, user & context of the default request key if not passed.
+//
+// Commands:
+//
+//	keys   [-limit 100] [-o table|json|csv] [prefix]   list keys by prefix, decoded into dimensions
+//	get    [-o table|json|csv] <key>...               show counts & ttls of the keys
+//	reset  [-prefix prefix] [key...]                  delete keys, resetting their counters. Prefix
+//	                                                  matches whole dimensions, e.g. an ip
+//	ban    -ttl 24h <key>...                          exhaust limits of the keys until ttl
+//	export [-o json|csv] [prefix]                     snapshot of all the keys by prefix
+//	overrides [-policy name]                          list overrides which are not expired
+//	override  -identity id (-limit n -period 1m | -multiplier 5) -ttl 2h [-policy name]
+//	revoke    -identity id [-policy name]             revoke override
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alter123/go-ratelimit/admin"
+	"github.com/alter123/go-ratelimit/limiter"
+	libredis "github.com/redis/go-redis/v9"
+)
+
+// BanCount is the counter set on banned keys, exceeding any sensible limit
+const BanCount = 1 << 40
+
+// DimensionSuffix names the dimensions following the ones of the key layout,
+// e.g. suffixes of pluggable limiters, plans & methods
+const DimensionSuffix = "suffix"
+
+// DimensionTier names the dimensions following the ones of the key layout which
+// mark the tier of the counter, i.e. override, plan:<name> & method:<method>
+const DimensionTier = "tier"
+
+// DefaultDimensions are the dimensions of the default request key, see goratelimit.BuildKeys
+var DefaultDimensions = []string{"ip", "path", "method", "user", "context"}
+
+const usage = `usage: ratelimitctl [-addr host:port] [-password ...] [-db n] [-prefix prefix] [-template template] <command> [flags] [args]
+
+commands:
+  keys   [-limit 100] [-o table|json|csv] [prefix]   list keys by prefix, decoded into dimensions
+  get    [-o table|json|csv] <key>...               show counts & ttls of the keys
+  reset  [-prefix prefix] [key...]                  delete keys, resetting their counters
+  ban    -ttl 24h <key>...                          exhaust limits of the keys until ttl
+  export [-o json|csv] [prefix]                     snapshot of all the keys by prefix
+  overrides [-policy name]                          list overrides which are not expired
+  override  -identity id (-limit n -period 1m | -multiplier 5) -ttl 2h [-policy name]
+  revoke    -identity id [-policy name]             revoke override
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "ratelimitctl:", err)
+		os.Exit(1)
+	}
+}
+
+// ctl is the connection to the store along with the prefix of the keys
+type ctl struct {
+	client    *libredis.Client
+	prefix    string
+	overrides limiter.OverrideStore
+	out       io.Writer
+	// Names of the dimensions of the keys, in order
+	dimensions []string
+}
+
+// Row is a key of the store decoded into its dimensions
+type Row struct {
+	admin.Key
+	Dimensions []Dimension `json:"dimensions"`
+}
+
+// Dimension of the key, named after the key layout
+type Dimension struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("ratelimitctl", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprint(out, usage) }
+	addr := fs.String("addr", "localhost:6379", "redis address")
+	password := fs.String("password", os.Getenv("REDIS_PASSWORD"), "redis password, defaults to $REDIS_PASSWORD")
+	db := fs.Int("db", 0, "redis database")
+	prefix := fs.String("prefix", "", "prefix of the keys, as LimiterOptions.Prefix")
+	template := fs.String("template", "", "key template of the limiter, e.g. ip|route, to name the dimensions of the keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command is required")
+	}
+
+	dimensions := DefaultDimensions
+	if *template != "" {
+		if _, err := limiter.ParseKeyTemplate(*template); err != nil {
+			return err
+		}
+		dimensions = strings.Split(*template, limiter.KeyJoinIdentifier)
+	}
+
+	client := libredis.NewClient(&libredis.Options{Addr: *addr, Password: *password, DB: *db})
+	defer client.Close()
+	c := &ctl{
+		client:     client,
+		prefix:     *prefix,
+		overrides:  limiter.NewRedisOverrideStore(client, *prefix+limiter.OverrideKeySuffix),
+		out:        out,
+		dimensions: dimensions,
+	}
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "keys":
+		return c.keys(ctx, args)
+	case "get":
+		return c.get(ctx, args)
+	case "reset":
+		return c.reset(ctx, args)
+	case "ban":
+		return c.ban(ctx, args)
+	case "export":
+		return c.export(ctx, args)
+	case "overrides":
+		return c.listOverrides(ctx, args)
+	case "override":
+		return c.setOverride(ctx, args)
+	case "revoke":
+		return c.revoke(ctx, args)
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func (c *ctl) keys(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "maximum number of keys, 0 lists all")
+	format := fs.String("o", "table", "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := admin.ScanKeys(ctx, c.client, c.prefix, fs.Arg(0), *limit)
+	if err != nil {
+		return err
+	}
+	return c.write(*format, keys)
+}
+
+func (c *ctl) get(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	format := fs.String("o", "table", "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("get: key is required")
+	}
+
+	keys, err := admin.GetKeys(ctx, c.client, c.prefix, fs.Args()...)
+	if err != nil {
+		return err
+	}
+	return c.write(*format, keys)
+}
+
+func (c *ctl) reset(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "reset all the keys by prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys := fs.Args()
+	if *prefix != "" {
+		scanned, err := admin.ScanKeys(ctx, c.client, c.prefix, *prefix, 0)
+		if err != nil {
+			return err
+		}
+		for _, k := range scanned {
+			keys = append(keys, k.Key)
+		}
+	} else if len(keys) == 0 {
+		return errors.New("reset: either key or -prefix is required")
+	}
+
+	deleted, err := admin.DeleteKeys(ctx, c.client, c.prefix, keys...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "reset %d keys\n", deleted)
+	return nil
+}
+
+// ban sets counters of the keys beyond the limits until ttl, the store retains
+// the ttl of existing keys on increments. E.g. `ban 203.0.113.7` bans the ip on
+// global limits & `ban user|42` bans the user on user global limits.
+func (c *ctl) ban(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ban", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "duration of the ban, e.g. 24h")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		return errors.New("ban: -ttl is required")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("ban: key is required")
+	}
+
+	pipe := c.client.Pipeline()
+	for _, k := range fs.Args() {
+		pipe.Set(ctx, c.prefix+":"+k, BanCount, *ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "banned %d keys until %s\n", fs.NArg(), time.Now().Add(*ttl).Format(time.RFC3339))
+	return nil
+}
+
+func (c *ctl) export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("o", "json", "output format: json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := admin.ScanKeys(ctx, c.client, c.prefix, fs.Arg(0), 0)
+	if err != nil {
+		return err
+	}
+	return c.write(*format, keys)
+}
+
+func (c *ctl) listOverrides(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	policy := fs.String("policy", "", "policy of the overrides, empty lists all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	overrides, err := c.overrides.List(ctx, *policy)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tIDENTITY\tLIMIT\tPERIOD\tMULTIPLIER\tEXPIRES_AT")
+	for _, o := range overrides {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%g\t%s\n", o.Policy, o.Identity, o.Limit, o.Period, o.Multiplier,
+			o.ExpiresAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func (c *ctl) setOverride(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("override", flag.ContinueOnError)
+	policy := fs.String("policy", "", "policy of the override, empty applies to all")
+	identity := fs.String("identity", "", "user id or ip")
+	limit := fs.Int64("limit", 0, "requests per period")
+	period := fs.Duration("period", 0, "period of the limit, e.g. 1m")
+	multiplier := fs.Float64("multiplier", 0, "multiplier of the request limits, e.g. 5")
+	ttl := fs.Duration("ttl", 0, "duration of the override, e.g. 2h")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		return errors.New("override: -ttl is required")
+	}
+
+	o := limiter.AbsoluteOverride(*policy, *identity, *limit, *period, *ttl)
+	if *multiplier != 0 {
+		o = limiter.MultiplierOverride(*policy, *identity, *multiplier, *ttl)
+		o.Limit, o.Period = *limit, *period
+	}
+	if err := c.overrides.Set(ctx, o); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "override of %s set until %s\n", o.Identity, o.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+func (c *ctl) revoke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	policy := fs.String("policy", "", "policy of the override")
+	identity := fs.String("identity", "", "user id or ip")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *identity == "" {
+		return errors.New("revoke: -identity is required")
+	}
+
+	if err := c.overrides.Delete(ctx, *policy, *identity); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "override of %s revoked\n", *identity)
+	return nil
+}
+
+// write keys in the format, decoded into dimensions
+func (c *ctl) write(format string, keys []admin.Key) error {
+	rows := make([]Row, len(keys))
+	for i, k := range keys {
+		rows[i] = Row{Key: k, Dimensions: DecodeKey(k.Key, c.dimensions)}
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "csv":
+		return writeCSV(c.out, rows, c.dimensions)
+	case "table":
+		return writeTable(c.out, rows)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// DecodeKey names the dimensions of the key after the dimensions of the key layout,
+// dimensions beyond the layout are named DimensionTier for counters of overrides,
+// plans & methods, DimensionSuffix otherwise. User global keys & global keys of
+// authenticated requests are decoded by their prefix.
+func DecodeKey(key string, dimensions []string) []Dimension {
+	parts := strings.Split(key, limiter.KeyJoinIdentifier)
+	if len(parts) > 1 {
+		switch parts[0] {
+		case limiter.UserGlobalKeyPrefix:
+			dimensions, parts = []string{"user"}, parts[1:]
+		case limiter.AuthenticatedGlobalKeyPrefix:
+			dimensions, parts = []string{"ip"}, parts[1:]
+		}
+	}
+
+	decoded := make([]Dimension, len(parts))
+	for i, part := range parts {
+		switch {
+		case i < len(dimensions):
+			decoded[i] = Dimension{Name: dimensions[i], Value: part}
+		case isTierDimension(part):
+			decoded[i] = Dimension{Name: DimensionTier, Value: part}
+		default:
+			decoded[i] = Dimension{Name: DimensionSuffix, Value: part}
+		}
+	}
+	return decoded
+}
+
+// isTierDimension validates if the dimension following the key layout marks the
+// counter of an override, plan or method
+func isTierDimension(part string) bool {
+	return part == limiter.TierOverride || strings.HasPrefix(part, limiter.PlanKeyPrefix) ||
+		strings.HasPrefix(part, limiter.MethodKeyPrefix)
+}
+
+// writeCSV writes a record per key with a field per dimension of the layout,
+// followed by the suffixes & tiers joined by KeyJoinIdentifier
+func writeCSV(out io.Writer, rows []Row, dimensions []string) error {
+	columns := append(append([]string{}, dimensions...), DimensionSuffix, DimensionTier)
+
+	w := csv.NewWriter(out)
+	if err := w.Write(append([]string{"key", "count", "ttl", "expires_at"}, columns...)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		expiresAt := ""
+		if row.ExpiresAt != nil {
+			expiresAt = row.ExpiresAt.Format(time.RFC3339)
+		}
+
+		values := map[string][]string{}
+		for _, d := range row.Dimensions {
+			values[d.Name] = append(values[d.Name], d.Value)
+		}
+		record := []string{row.Key.Key, strconv.FormatInt(row.Count, 10), row.TTL, expiresAt}
+		for _, column := range columns {
+			record = append(record, strings.Join(values[column], limiter.KeyJoinIdentifier))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeTable(out io.Writer, rows []Row) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tCOUNT\tTTL\tDIMENSIONS")
+	for _, row := range rows {
+		dimensions := make([]string, len(row.Dimensions))
+		for i, d := range row.Dimensions {
+			dimensions[i] = fmt.Sprintf("%s=%q", d.Name, d.Value)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", row.Key.Key, row.Count, row.TTL, strings.Join(dimensions, " "))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	mockredis "github.com/alicebob/miniredis/v2"
+)
+
+func TestCommands(t *testing.T) {
+	s, err := mockredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Set("tbrl:203.0.113.40|/login|POST||", "3")
+	s.SetTTL("tbrl:203.0.113.40|/login|POST||", time.Minute)
+	s.Set("tbrl:203.0.113.40", "7")
+
+	ctl := func(args ...string) string {
+		var out bytes.Buffer
+		if err := run(context.Background(), append([]string{"-addr", s.Addr(), "-prefix", "tbrl"}, args...), &out); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	var rows []Row
+	if err = json.Unmarshal([]byte(ctl("keys", "-o", "json", "203.0.113.40|")), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Count != 3 || rows[0].TTL == "" || len(rows[0].Dimensions) != 5 ||
+		rows[0].Dimensions[1] != (Dimension{Name: "path", Value: "/login"}) {
+		t.Fatalf("Keys are not decoded: %+v", rows)
+	}
+
+	// Dimensions are named after the key template, suffixes follow them
+	if dimensions := DecodeKey("203.0.113.40|/login|burst", []string{"ip", "route"}); len(dimensions) != 3 ||
+		dimensions[1].Name != "route" || dimensions[2] != (Dimension{Name: DimensionSuffix, Value: "burst"}) {
+		t.Fatalf("Key is not decoded by template: %+v", dimensions)
+	}
+	if dimensions := DecodeKey("user|42", DefaultDimensions); len(dimensions) != 1 || dimensions[0].Name != "user" {
+		t.Fatalf("User global key is not decoded: %+v", dimensions)
+	}
+
+	// Counters of overrides follow the request key
+	if dimensions := DecodeKey("203.0.113.40|/login|POST|||override|method:POST", DefaultDimensions); len(dimensions) != 7 ||
+		dimensions[1] != (Dimension{Name: "path", Value: "/login"}) ||
+		dimensions[5] != (Dimension{Name: DimensionTier, Value: "override"}) ||
+		dimensions[6] != (Dimension{Name: DimensionTier, Value: "method:POST"}) {
+		t.Fatalf("Override key is not decoded: %+v", dimensions)
+	}
+
+	ctl("ban", "-ttl", "1h", "203.0.113.40")
+	if v, _ := s.Get("tbrl:203.0.113.40"); v != "1099511627776" || s.TTL("tbrl:203.0.113.40") != time.Hour {
+		t.Fatalf("Key is not banned: %s %s", v, s.TTL("tbrl:203.0.113.40"))
+	}
+
+	records, err := csv.NewReader(strings.NewReader(ctl("export", "-o", "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "key" || records[0][4] != "ip" || records[0][9] != DimensionSuffix ||
+		records[0][10] != DimensionTier {
+		t.Fatalf("Keys are not exported: %v", records)
+	}
+
+	ctl("override", "-identity", "203.0.113.40", "-multiplier", "5", "-ttl", "2h")
+	if out := ctl("overrides"); !strings.Contains(out, "203.0.113.40") {
+		t.Fatalf("Override is not listed: %s", out)
+	}
+	ctl("revoke", "-identity", "203.0.113.40")
+	if out := ctl("overrides"); strings.Contains(out, "203.0.113.40") {
+		t.Fatalf("Override is not revoked: %s", out)
+	}
+
+	// Prefix matches the whole ip, not the ips it's a prefix of
+	s.Set("tbrl:203.0.113.4|/login|POST||", "1")
+	ctl("reset", "-prefix", "203.0.113.4")
+	if keys := s.Keys(); len(keys) != 2 {
+		t.Fatalf("Keys of other ips are reset: %v", keys)
+	}
+
+	ctl("reset", "-prefix", "203.0.113.40")
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Fatalf("Keys are not reset: %v", keys)
+	}
+}
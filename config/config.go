@@ -0,0 +1,238 @@
+// Package config loads declarative rate limit policies from YAML or JSON files
+// into limiters & a router, instead of chaining setters on limiter per route.
+//
+//	policies:
+//	  - name: login
+//	    routes: ["/login", "/password/*"]
+//	    methods: [POST]
+//	    keys: "ip|route"
+//	    limit: 5
+//	    period: 1m
+//	    global: {limit: 60, period: 1m}
+//	    pluggable:
+//	      - {suffix: burst, limit: 2, period: 1s}
+//	    plans:
+//	      pro: {limit: 50, period: 1m}
+//	    allow: {ips: ["10.0.0.0/8"]}
+//
+// limiter.Init must be called before building the policies.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+	"gopkg.in/yaml.v3"
+)
+
+// Format of the configuration file
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// File is the declarative configuration of rate limit policies
+type File struct {
+	Policies []Policy `json:"policies" yaml:"policies"`
+}
+
+// Policy configures limiter & the routes it applies to
+type Policy struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Route patterns, either exact path, prefix ending with "/*", or "*" for all
+	Routes []string `json:"routes" yaml:"routes"`
+	// Methods the routes apply to, empty applies to all methods
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+
+	// Key template of request keys, see limiter.ParseKeyTemplate
+	Keys string `json:"keys,omitempty" yaml:"keys,omitempty"`
+
+	// Request limits
+	Rate `yaml:",inline"`
+
+	Global    *Rate           `json:"global,omitempty" yaml:"global,omitempty"`
+	Pluggable []PluggableRate `json:"pluggable,omitempty" yaml:"pluggable,omitempty"`
+
+	// Global limits of authenticated requests, per user & per ip
+	UserGlobal          *Rate `json:"user_global,omitempty" yaml:"user_global,omitempty"`
+	AuthenticatedGlobal *Rate `json:"authenticated_global,omitempty" yaml:"authenticated_global,omitempty"`
+	// Apply pluggable limits to authenticated requests, per user
+	PluggableForAuthenticated bool `json:"pluggable_for_authenticated,omitempty" yaml:"pluggable_for_authenticated,omitempty"`
+
+	// Request limits per plan, plan resolver is to be set on the built limiter
+	Plans map[string]Rate `json:"plans,omitempty" yaml:"plans,omitempty"`
+	// Request limits per HTTP method, e.g. stricter limits for POST
+	MethodLimits map[string]Rate `json:"method_limits,omitempty" yaml:"method_limits,omitempty"`
+
+	IPLookups      []string `json:"ip_lookups,omitempty" yaml:"ip_lookups,omitempty"`
+	TrustedProxies []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+	// Index of client address in forwarded headers from the right-most hop
+	ForwardedForIndex int     `json:"forwarded_for_index,omitempty" yaml:"forwarded_for_index,omitempty"`
+	IPMask            *IPMask `json:"ip_mask,omitempty" yaml:"ip_mask,omitempty"`
+	GlobalIPMask      *IPMask `json:"global_ip_mask,omitempty" yaml:"global_ip_mask,omitempty"`
+
+	Allow *AccessList `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  *AccessList `json:"deny,omitempty" yaml:"deny,omitempty"`
+	Skip  *Skip       `json:"skip,omitempty" yaml:"skip,omitempty"`
+
+	// Outcome of requests without identity, either skip, reject or fallback
+	MissingIdentity    string `json:"missing_identity,omitempty" yaml:"missing_identity,omitempty"`
+	MissingIdentityKey string `json:"missing_identity_key,omitempty" yaml:"missing_identity_key,omitempty"`
+
+	// Evaluate limits of the policy without enforcing them
+	Shadow bool `json:"shadow,omitempty" yaml:"shadow,omitempty"`
+
+	IgnoreURL     bool  `json:"ignore_url,omitempty" yaml:"ignore_url,omitempty"`
+	IncludeUserId *bool `json:"include_user_id,omitempty" yaml:"include_user_id,omitempty"`
+}
+
+// Rate is the maximum number of requests per period
+type Rate struct {
+	Limit  int64    `json:"limit" yaml:"limit"`
+	Period Duration `json:"period" yaml:"period"`
+}
+
+// PluggableRate is the rate of pluggable limiter, identified by suffix on keys
+type PluggableRate struct {
+	Suffix string `json:"suffix" yaml:"suffix"`
+	Rate   `yaml:",inline"`
+	// Evaluate the limits without enforcing them
+	Shadow bool `json:"shadow,omitempty" yaml:"shadow,omitempty"`
+}
+
+// IPMask aggregates IP addresses into networks of the prefix length
+type IPMask struct {
+	IPv4 int `json:"ipv4,omitempty" yaml:"ipv4,omitempty"`
+	IPv6 int `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+}
+
+// AccessList of IPs, CIDRs & user ids
+type AccessList struct {
+	IPs     []string `json:"ips,omitempty" yaml:"ips,omitempty"`
+	UserIds []string `json:"user_ids,omitempty" yaml:"user_ids,omitempty"`
+}
+
+// Skip rules to bypass the limiter
+type Skip struct {
+	Paths        []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+	PathPrefixes []string `json:"path_prefixes,omitempty" yaml:"path_prefixes,omitempty"`
+	Methods      []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+}
+
+// Duration is time.Duration represented as string, e.g. "1m30s"
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1m\", got %s", b)
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: duration must be a string such as \"1m\"", value.Line)
+	}
+	if err := d.parse(value.Value); err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	return nil
+}
+
+func (d *Duration) parse(s string) error {
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected format such as \"1m\" or \"1h30m\"", s)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// FormatFromPath determines format of the file from its extension
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("%w: unsupported file %q, expected .yaml, .yml or .json", limiter.ErrInvalidConfig, path)
+}
+
+// ReadFile reads & parses configuration file, format is determined from extension
+func ReadFile(path string) (*File, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Parse parses configuration, unknown fields are rejected to catch typos
+func Parse(data []byte, format Format) (*File, error) {
+	f := &File{}
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(f); err != nil {
+			return nil, fmt.Errorf("%w: yaml: %v", limiter.ErrInvalidConfig, err)
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(f); err != nil {
+			return nil, fmt.Errorf("%w: json: %v", limiter.ErrInvalidConfig, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", limiter.ErrInvalidConfig, format)
+	}
+	return f, nil
+}
+
+// Load reads, validates & builds the policies of configuration file,
+// see Reloader to reload the policies at runtime
+func Load(path string) (*Policies, error) {
+	f, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := f.Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policies, nil
+}
@@ -0,0 +1,153 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/config"
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+const policiesYAML = `
+policies:
+  - name: login
+    routes: ["/login", "/password/*"]
+    methods: [post]
+    keys: "ip|route"
+    limit: 5
+    period: 1m
+    global: {limit: 30, period: 1m}
+    pluggable:
+      - {suffix: burst, limit: 2, period: 1s}
+  - name: default
+    routes: ["*"]
+    limit: 100
+    period: 1m
+    allow: {ips: ["10.0.0.0/8"]}
+`
+
+func TestBuild(t *testing.T) {
+	f, err := config.Parse([]byte(policiesYAML), config.FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := f.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := policies.Limiters["login"]
+	if login.GetLimits() != 5 || login.GetTtl() != time.Minute || login.GetGlobalLimits() != 30 ||
+		login.GetKeyTemplate() != "ip|route" {
+		t.Fatal("Login limiter is not configured.")
+	}
+
+	for path, expected := range map[string]string{
+		"/login":          "login",
+		"/password/reset": "login",
+		"/passwords":      "default",
+		"/":               "default",
+	} {
+		r, err := http.NewRequest("POST", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, policy := policies.Router.Match(r); policy != expected {
+			t.Fatalf("Policy of %s is %q, expected %q.", path, policy, expected)
+		}
+	}
+
+	r, err := http.NewRequest("GET", "/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, policy := policies.Router.Match(r); policy != "default" {
+		t.Fatalf("Policy of GET /login is %q, expected default.", policy)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f, err := config.Parse([]byte(`{"policies": [
+		{"name": "a", "routes": ["api"], "keys": "ip|bogus", "limit": 0, "period": "1m",
+		 "pluggable": [{"suffix": "s", "limit": 1, "period": "1s"}, {"suffix": "s", "limit": 1, "period": "1s"}],
+		 "deny": {"ips": ["10.0.0.0/33"]}, "missing_identity": "ignore"},
+		{"name": "a", "routes": ["/"], "limit": 1, "period": "1m"}
+	]}`), config.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verr *config.ValidationError
+	if _, err = f.Build(); !errors.As(err, &verr) || !errors.Is(err, limiter.ErrInvalidConfig) {
+		t.Fatalf("Config is not invalid: %v", err)
+	}
+
+	for _, field := range []string{
+		"policies[0] (a).routes[0]", "policies[0] (a).keys", "policies[0] (a).limit",
+		"policies[0] (a).pluggable[1].suffix", "policies[0] (a).deny.ips[0]",
+		"policies[0] (a).missing_identity", "policies[1] (a).name",
+	} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Fatalf("Problem with %s is not reported: %v", field, err)
+		}
+	}
+
+	if _, err = config.Parse([]byte("policies:\n  - nmae: typo\n"), config.FormatYAML); err == nil {
+		t.Fatal("Unknown field is not rejected.")
+	}
+	if _, err = config.Parse([]byte(`{"policies": [{"period": 60}]}`), config.FormatJSON); err == nil {
+		t.Fatal("Numeric duration is not rejected.")
+	}
+}
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(policiesYAML)
+
+	configured := 0
+	rl, err := config.NewReloader(path, func(policy string, lmt *limiter.Limiter) {
+		configured++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := rl.Policies().Limiters["login"]
+	write(strings.Replace(policiesYAML, "limit: 5", "limit: 1", 1))
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if rl.Policies().Limiters["login"].GetLimits() != 1 || previous.GetLimits() != 5 {
+		t.Fatal("Policies are not swapped.")
+	}
+	if configured != 4 {
+		t.Fatalf("Limiters are configured %d times, expected 4.", configured)
+	}
+
+	// Invalid configuration retains the current policies
+	write(strings.Replace(policiesYAML, "limit: 5", "limit: -1", 1))
+	if err := rl.Reload(); err == nil {
+		t.Fatal("Invalid config is reloaded.")
+	}
+	if rl.Policies().Limiters["login"].GetLimits() != 1 {
+		t.Fatal("Policies are not retained.")
+	}
+
+	w := httptest.NewRecorder()
+	rl.ServeHTTP(w, httptest.NewRequest("POST", "/reload", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Reload API responded with %d.", w.Code)
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	goratelimit "github.com/alter123/go-ratelimit"
+	"github.com/alter123/go-ratelimit/libstring"
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+// Policies are limiters built from configuration, along with the router
+type Policies struct {
+	// Limiters by policy name
+	Limiters map[string]*limiter.Limiter
+	Router   *Router
+}
+
+// ConfigureFunc customizes limiter of the policy after it's built from configuration
+type ConfigureFunc func(policy string, lmt *limiter.Limiter)
+
+// Build validates configuration & builds limiters of the policies
+func (f *File) Build() (*Policies, error) {
+	return f.BuildWith(nil)
+}
+
+// BuildWith builds limiters of the policies & customizes them via configure
+func (f *File) BuildWith(configure ConfigureFunc) (*Policies, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	policies := &Policies{
+		Limiters: make(map[string]*limiter.Limiter, len(f.Policies)),
+		Router:   &Router{},
+	}
+	for _, p := range f.Policies {
+		lmt, err := p.newLimiter()
+		if err != nil {
+			return nil, err
+		}
+		if configure != nil {
+			configure(p.Name, lmt)
+		}
+		policies.Limiters[p.Name] = lmt
+		policies.Router.add(p, lmt)
+	}
+	return policies, nil
+}
+
+func (p Policy) newLimiter() (*limiter.Limiter, error) {
+	lmt := goratelimit.NewLimiter(p.Limit, time.Duration(p.Period)).SetName(p.Name).SetShadow(p.Shadow)
+
+	if p.Keys != "" {
+		if _, err := lmt.SetKeyTemplate(p.Keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Global != nil {
+		lmt.SetGlobalLimits(p.Global.Limit).SetGlobalTtl(time.Duration(p.Global.Period))
+	}
+
+	if p.UserGlobal != nil {
+		lmt.SetUserGlobalLimits(goratelimit.NewExpirableOption(p.UserGlobal.Limit, time.Duration(p.UserGlobal.Period), ""))
+	}
+	if p.AuthenticatedGlobal != nil {
+		lmt.SetAuthenticatedGlobalLimits(goratelimit.NewExpirableOption(
+			p.AuthenticatedGlobal.Limit, time.Duration(p.AuthenticatedGlobal.Period), ""))
+	}
+	lmt.SetPluggableForAuthenticated(p.PluggableForAuthenticated)
+
+	if len(p.Pluggable) > 0 {
+		eo := make([]limiter.ExpirableOptions, len(p.Pluggable))
+		for i, pr := range p.Pluggable {
+			eo[i] = goratelimit.NewExpirableOption(pr.Limit, time.Duration(pr.Period), pr.Suffix)
+			eo[i].Shadow = pr.Shadow
+		}
+		lmt.SetPluggableLimiter(eo)
+	}
+
+	if len(p.Plans) > 0 {
+		plans := make(map[string]limiter.ExpirableOptions, len(p.Plans))
+		for name, rate := range p.Plans {
+			plans[name] = goratelimit.NewExpirableOption(rate.Limit, time.Duration(rate.Period), "")
+		}
+		lmt.SetPlans(plans)
+	}
+
+	if len(p.MethodLimits) > 0 {
+		methodLimits := make(map[string]limiter.ExpirableOptions, len(p.MethodLimits))
+		for method, rate := range p.MethodLimits {
+			methodLimits[method] = goratelimit.NewExpirableOption(rate.Limit, time.Duration(rate.Period), "")
+		}
+		lmt.SetMethodLimits(methodLimits)
+	}
+
+	if len(p.IPLookups) > 0 {
+		lmt.SetIPLookups(p.IPLookups)
+	}
+	if len(p.TrustedProxies) > 0 {
+		trustedProxies, err := libstring.ParseCIDRs(p.TrustedProxies...)
+		if err != nil {
+			return nil, err
+		}
+		lmt.SetTrustedProxies(trustedProxies)
+	}
+	lmt.SetForwardedForIndexFromBehind(p.ForwardedForIndex)
+	if p.IPMask != nil {
+		lmt.SetIPMask(p.IPMask.IPv4, p.IPMask.IPv6)
+	}
+	if p.GlobalIPMask != nil {
+		lmt.SetGlobalIPMask(p.GlobalIPMask.IPv4, p.GlobalIPMask.IPv6)
+	}
+
+	if p.Allow != nil {
+		networks, err := libstring.ParseCIDRs(p.Allow.IPs...)
+		if err != nil {
+			return nil, err
+		}
+		lmt.SetAllowList(networks, p.Allow.UserIds...)
+	}
+	if p.Deny != nil {
+		networks, err := libstring.ParseCIDRs(p.Deny.IPs...)
+		if err != nil {
+			return nil, err
+		}
+		lmt.SetDenyList(networks, p.Deny.UserIds...)
+	}
+
+	if p.Skip != nil {
+		var skippers []limiter.Skipper
+		if len(p.Skip.Paths) > 0 {
+			skippers = append(skippers, limiter.SkipPaths(p.Skip.Paths...))
+		}
+		if len(p.Skip.PathPrefixes) > 0 {
+			skippers = append(skippers, limiter.SkipPathPrefixes(p.Skip.PathPrefixes...))
+		}
+		if len(p.Skip.Methods) > 0 {
+			skippers = append(skippers, limiter.SkipMethods(p.Skip.Methods...))
+		}
+		lmt.SetSkippers(skippers...)
+	}
+
+	missingIdentity, err := missingIdentityPolicy(p.MissingIdentity)
+	if err != nil {
+		return nil, err
+	}
+	lmt.SetMissingIdentityPolicy(missingIdentity).SetMissingIdentityKey(p.MissingIdentityKey)
+
+	lmt.SetIgnoreURL(p.IgnoreURL)
+	if p.IncludeUserId != nil {
+		lmt.SetIncludeUserId(*p.IncludeUserId)
+	}
+
+	return lmt.Build()
+}
+
+// Router matches requests to the limiter of the policy, routes are matched
+// in the order of declaration in configuration
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	pattern string
+	methods map[string]bool
+	policy  string
+	limiter *limiter.Limiter
+}
+
+func (rt *Router) add(p Policy, lmt *limiter.Limiter) {
+	var methods map[string]bool
+	if len(p.Methods) > 0 {
+		methods = make(map[string]bool, len(p.Methods))
+		for _, method := range p.Methods {
+			methods[strings.ToUpper(method)] = true
+		}
+	}
+
+	for _, pattern := range p.Routes {
+		rt.routes = append(rt.routes, route{
+			pattern: pattern,
+			methods: methods,
+			policy:  p.Name,
+			limiter: lmt,
+		})
+	}
+}
+
+func (rt route) matches(r *http.Request) bool {
+	if rt.methods != nil && !rt.methods[r.Method] {
+		return false
+	}
+
+	path := r.URL.Path
+	switch {
+	case rt.pattern == "*":
+		return true
+	case strings.HasSuffix(rt.pattern, "/*"):
+		prefix := strings.TrimSuffix(rt.pattern, "/*")
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	case strings.HasSuffix(rt.pattern, "*"):
+		return strings.HasPrefix(path, strings.TrimSuffix(rt.pattern, "*"))
+	}
+	return path == rt.pattern
+}
+
+// Match finds limiter & name of the policy of the request, nil if no route matches
+func (rt *Router) Match(r *http.Request) (*limiter.Limiter, string) {
+	for _, route := range rt.routes {
+		if route.matches(r) {
+			return route.limiter, route.policy
+		}
+	}
+	return nil, ""
+}
+
+// LimitByRequest limits request by the matched policy, requests which don't
+// match any route are not limited
+func (rt *Router) LimitByRequest(r *http.Request) (limiter.Context, error) {
+	lmt, _ := rt.Match(r)
+	if lmt == nil {
+		return limiter.Context{}, nil
+	}
+	return goratelimit.LimitByRequest(lmt, r)
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+// Reloader loads policies from configuration file & reloads them at runtime,
+// triggered by file watch, signal or an API call. Policies are swapped
+// atomically & an invalid configuration retains the current policies.
+type Reloader struct {
+	path string
+
+	// Configure is applied on the limiters of every build, e.g. to set
+	// plan resolvers or identity sources which can't be defined in file
+	Configure ConfigureFunc
+
+	// OnReload is invoked after every reload attempt
+	OnReload func(policies *Policies, err error)
+
+	policies atomic.Value
+	// Serializes reloads & guards the content of the file last attempted
+	mu   sync.Mutex
+	data []byte
+}
+
+// NewReloader loads policies of the configuration file
+func NewReloader(path string, configure ConfigureFunc) (*Reloader, error) {
+	rl := &Reloader{path: path, Configure: configure}
+	if _, err := rl.reload(true); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+// Policies returns the current policies
+func (rl *Reloader) Policies() *Policies {
+	return rl.policies.Load().(*Policies)
+}
+
+// LimitByRequest limits request by the current policies
+func (rl *Reloader) LimitByRequest(r *http.Request) (limiter.Context, error) {
+	return rl.Policies().Router.LimitByRequest(r)
+}
+
+// Reload re-reads configuration file & swaps the policies, current policies
+// are retained if the configuration is invalid
+func (rl *Reloader) Reload() error {
+	_, err := rl.reload(true)
+	return err
+}
+
+// reload builds policies of the file, unchanged file is skipped unless forced
+func (rl *Reloader) reload(force bool) (bool, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	data, err := ioutil.ReadFile(rl.path)
+	if err == nil && !force && bytes.Equal(data, rl.data) {
+		return false, nil
+	}
+
+	var policies *Policies
+	if err == nil {
+		// Invalid content is not retried by watch until the file changes
+		rl.data = data
+		policies, err = rl.build(data)
+	}
+	if err == nil {
+		rl.policies.Store(policies)
+		limiter.GetLogger().Log(limiter.LevelInfo, "rate limit policies reloaded",
+			limiter.F("path", rl.path), limiter.F("policies", len(policies.Limiters)))
+	} else {
+		limiter.GetLogger().Log(limiter.LevelError, "rate limit policies reload failed",
+			limiter.F("path", rl.path), limiter.F("error", err))
+	}
+
+	if rl.OnReload != nil {
+		rl.OnReload(policies, err)
+	}
+	return true, err
+}
+
+func (rl *Reloader) build(data []byte) (*Policies, error) {
+	format, err := FormatFromPath(rl.path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := Parse(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return f.BuildWith(rl.Configure)
+}
+
+// Watch polls configuration file for changes every interval until ctx is done
+func (rl *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Errors are reported via OnReload
+			rl.reload(false)
+		}
+	}
+}
+
+// ReloadOnSignal reloads policies upon the signals until ctx is done,
+// defaults to SIGHUP
+func (rl *Reloader) ReloadOnSignal(ctx context.Context, sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			rl.Reload()
+		}
+	}
+}
+
+// ServeHTTP reloads policies upon POST request, to be mounted on an internal route
+func (rl *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := rl.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
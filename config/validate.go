@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alter123/go-ratelimit/libstring"
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+// ValidationError lists all the problems found in configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return limiter.ErrInvalidConfig.Error() + ":\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == limiter.ErrInvalidConfig
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, field+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate validates configuration, returns *ValidationError listing all the problems
+func (f *File) Validate() error {
+	v := &validator{}
+
+	if len(f.Policies) == 0 {
+		v.addf("policies", "at least one policy is required")
+	}
+
+	names := make(map[string]int, len(f.Policies))
+	for i := range f.Policies {
+		p := &f.Policies[i]
+		field := fmt.Sprintf("policies[%d]", i)
+		if p.Name != "" {
+			field = fmt.Sprintf("policies[%d] (%s)", i, p.Name)
+		}
+
+		if p.Name == "" {
+			v.addf(field+".name", "is required")
+		} else if j, exists := names[p.Name]; exists {
+			v.addf(field+".name", "duplicates name of policies[%d]", j)
+		} else {
+			names[p.Name] = i
+		}
+
+		v.validatePolicy(field, p)
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+func (v *validator) validatePolicy(field string, p *Policy) {
+	if len(p.Routes) == 0 {
+		v.addf(field+".routes", "at least one route is required")
+	}
+	for i, route := range p.Routes {
+		if route != "*" && !strings.HasPrefix(route, "/") {
+			v.addf(fmt.Sprintf("%s.routes[%d]", field, i), "%q must be \"*\" or start with \"/\"", route)
+		}
+		if strings.Contains(strings.TrimSuffix(route, "*"), "*") {
+			v.addf(fmt.Sprintf("%s.routes[%d]", field, i), "%q may only end with \"*\"", route)
+		}
+	}
+
+	if p.Keys != "" {
+		if _, err := limiter.ParseKeyTemplate(p.Keys); err != nil {
+			v.addf(field+".keys", "%v", err)
+		}
+	}
+
+	v.validateRate(field, p.Rate)
+	if p.Global != nil {
+		v.validateRate(field+".global", *p.Global)
+	}
+	if p.UserGlobal != nil {
+		v.validateRate(field+".user_global", *p.UserGlobal)
+	}
+	if p.AuthenticatedGlobal != nil {
+		v.validateRate(field+".authenticated_global", *p.AuthenticatedGlobal)
+	}
+
+	suffixes := make(map[string]bool, len(p.Pluggable))
+	for i, pr := range p.Pluggable {
+		prField := fmt.Sprintf("%s.pluggable[%d]", field, i)
+		if pr.Suffix == "" {
+			v.addf(prField+".suffix", "is required")
+		} else if suffixes[pr.Suffix] {
+			v.addf(prField+".suffix", "duplicate suffix %q", pr.Suffix)
+		}
+		suffixes[pr.Suffix] = true
+		v.validateRate(prField, pr.Rate)
+	}
+
+	for name, rate := range p.Plans {
+		if name == "" {
+			v.addf(field+".plans", "plan name is required")
+		}
+		v.validateRate(fmt.Sprintf("%s.plans.%s", field, name), rate)
+	}
+
+	methods := make(map[string]bool, len(p.MethodLimits))
+	for method, rate := range p.MethodLimits {
+		if methods[strings.ToUpper(method)] {
+			v.addf(field+".method_limits", "duplicate method %q", method)
+		}
+		methods[strings.ToUpper(method)] = true
+		v.validateRate(fmt.Sprintf("%s.method_limits.%s", field, method), rate)
+	}
+
+	v.validateCIDRs(field+".trusted_proxies", p.TrustedProxies)
+	if p.ForwardedForIndex < 0 {
+		v.addf(field+".forwarded_for_index", "must not be negative, got %d", p.ForwardedForIndex)
+	}
+	if p.Allow != nil {
+		v.validateCIDRs(field+".allow.ips", p.Allow.IPs)
+	}
+	if p.Deny != nil {
+		v.validateCIDRs(field+".deny.ips", p.Deny.IPs)
+	}
+
+	v.validateIPMask(field+".ip_mask", p.IPMask)
+	v.validateIPMask(field+".global_ip_mask", p.GlobalIPMask)
+
+	if _, err := missingIdentityPolicy(p.MissingIdentity); err != nil {
+		v.addf(field+".missing_identity", "%v", err)
+	}
+}
+
+func (v *validator) validateRate(field string, rate Rate) {
+	if rate.Limit <= 0 {
+		v.addf(field+".limit", "must be positive, got %d", rate.Limit)
+	}
+	if rate.Period <= 0 {
+		v.addf(field+".period", "must be positive, got %q", rate.Period)
+	}
+}
+
+func (v *validator) validateCIDRs(field string, cidrs []string) {
+	for i, cidr := range cidrs {
+		if _, err := libstring.ParseCIDRs(cidr); err != nil {
+			v.addf(fmt.Sprintf("%s[%d]", field, i), "%v", err)
+		}
+	}
+}
+
+func (v *validator) validateIPMask(field string, mask *IPMask) {
+	if mask == nil {
+		return
+	}
+	if mask.IPv4 < 0 || mask.IPv4 > 32 {
+		v.addf(field+".ipv4", "must be between 0 and 32, got %d", mask.IPv4)
+	}
+	if mask.IPv6 < 0 || mask.IPv6 > 128 {
+		v.addf(field+".ipv6", "must be between 0 and 128, got %d", mask.IPv6)
+	}
+}
+
+func missingIdentityPolicy(name string) (limiter.MissingIdentityPolicy, error) {
+	switch name {
+	case "", "skip":
+		return limiter.MissingIdentitySkip, nil
+	case "reject":
+		return limiter.MissingIdentityReject, nil
+	case "fallback":
+		return limiter.MissingIdentityFallback, nil
+	}
+	return 0, fmt.Errorf("unknown policy %q, expected skip, reject or fallback", name)
+}
@@ -0,0 +1,190 @@
+package goratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+// Decisions of the explained request
+const (
+	DecisionAllow  = "allow"
+	DecisionReject = "reject"
+	DecisionDeny   = "deny"
+	DecisionSkip   = "skip"
+)
+
+// Explanation of the rate limit decision of a request
+type Explanation struct {
+	Policy string `json:"policy,omitempty"`
+	// Remote ip used on the keys & the lookup it's found by, e.g. X-Forwarded-For
+	IP       string `json:"ip"`
+	IPLookup string `json:"ip_lookup,omitempty"`
+	UserId   string `json:"user_id,omitempty"`
+	Method   string `json:"method"`
+	// Path used on the keys
+	Path string `json:"path"`
+	Plan string `json:"plan,omitempty"`
+	// Limiter is in shadow mode, rejections are not enforced
+	Shadow bool `json:"shadow,omitempty"`
+
+	Keys *limiter.LimiterKeys `json:"keys,omitempty"`
+	// Counters of every tier evaluated, reached tiers would reject the request
+	Tiers []limiter.TierContext `json:"tiers,omitempty"`
+
+	// Decision the limiter would make & the tier deciding it. Allowed requests
+	// report the shadow tier which would have rejected them, if any.
+	Decision     string               `json:"decision"`
+	DecidingTier *limiter.TierContext `json:"deciding_tier,omitempty"`
+}
+
+// Explain evaluates limits of the request without consuming quota, reporting
+// extracted identity, keys, counters of all the tiers & the tier which would decide.
+// Observers, store hooks & logger are not notified.
+func Explain(lmt *limiter.Limiter, r *http.Request) (*Explanation, error) {
+	e := &Explanation{
+		Policy: lmt.GetName(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Shadow: lmt.GetShadow(),
+	}
+	e.IP, e.IPLookup = lmt.RemoteIPLookup(r)
+	if lmt.GetIncludeUserId() {
+		if userId, err := lmt.GetUserId(r); err == nil {
+			e.UserId = userId
+		}
+	}
+
+	lmtCtx, sliceKeys, skipped, err := limitByRequest(lmt, r.WithContext(limiter.PeekContext(r.Context())))
+	if err != nil {
+		return nil, err
+	}
+	e.Keys, e.Tiers = sliceKeys, lmtCtx.Tiers
+	if sliceKeys != nil {
+		e.Plan = sliceKeys.Plan
+	}
+
+	switch {
+	case skipped:
+		e.Decision = DecisionSkip
+	case lmtCtx.Denied:
+		e.Decision = DecisionDeny
+		tier := lmtCtx.TierContext()
+		e.DecidingTier = &tier
+	default:
+		e.Decision = DecisionAllow
+		if tier, ok := rejectingTier(lmtCtx.Tiers); ok {
+			e.Decision = DecisionReject
+			e.DecidingTier = &tier
+		} else if tier, ok := lmtCtx.ShadowTier(); ok {
+			e.DecidingTier = &tier
+		}
+	}
+	return e, nil
+}
+
+// rejectingTier returns the first reached tier which isn't in shadow mode
+func rejectingTier(tiers []limiter.TierContext) (limiter.TierContext, bool) {
+	for _, t := range tiers {
+		if t.Reached && !t.Shadow {
+			return t, true
+		}
+	}
+	return limiter.TierContext{}, false
+}
+
+// RequestDescription describes synthetic request to explain
+type RequestDescription struct {
+	Method string
+	// Path along with optional query, e.g. /search?q=go
+	Path string
+	// Remote address of the connection, either ip or ip:port
+	RemoteAddr string
+	Header     http.Header
+}
+
+// NewRequest creates synthetic request of the description
+func NewRequest(d RequestDescription) (*http.Request, error) {
+	method := d.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !strings.HasPrefix(d.Path, "/") {
+		return nil, errors.New("path must start with /")
+	}
+
+	r, err := http.NewRequest(strings.ToUpper(method), d.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.RemoteAddr = d.RemoteAddr
+	for name, values := range d.Header {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	return r, nil
+}
+
+// ExplainHandler explains the decision of synthetic request described by query
+// params: method, path, remote_addr & repeated header as "Name: value", e.g.
+//
+//	/explain?path=/login&method=POST&remote_addr=203.0.113.7&header=X-API-Key:+abc
+//
+// Limiter of the request is resolved via match, nil if none applies.
+// To be mounted on an internal route.
+func ExplainHandler(match func(r *http.Request) *limiter.Limiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		explained, err := NewRequestFromQuery(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		lmt := match(explained)
+		if lmt == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no limiter applies to the request"})
+			return
+		}
+
+		e, err := Explain(lmt, explained)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, limiter.ErrStoreUnavailable) {
+				status = http.StatusServiceUnavailable
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+	})
+}
+
+// NewRequestFromQuery creates synthetic request described by query params:
+// method, path, remote_addr & repeated header as "Name: value"
+func NewRequestFromQuery(query url.Values) (*http.Request, error) {
+	d := RequestDescription{
+		Method:     query.Get("method"),
+		Path:       query.Get("path"),
+		RemoteAddr: query.Get("remote_addr"),
+		Header:     http.Header{},
+	}
+	for _, header := range query["header"] {
+		i := strings.Index(header, ":")
+		if i <= 0 {
+			return nil, errors.New("header must be formatted as \"Name: value\"")
+		}
+		d.Header.Add(strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:]))
+	}
+	return NewRequest(d)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
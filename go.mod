@@ -6,4 +6,5 @@ require (
 	github.com/alicebob/miniredis/v2 v2.15.1
 	github.com/redis/go-redis/v9 v9.0.2
 	github.com/ulule/limiter/v3 v3.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
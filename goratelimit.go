@@ -1,10 +1,12 @@
 package goratelimit
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"time"
 
-	"github.com/alter123/go-ratelimit/libstring"
 	"github.com/alter123/go-ratelimit/limiter"
 )
 
@@ -22,6 +24,12 @@ func NewLimiter(max int64, ttl time.Duration) *limiter.Limiter {
 	return limiter.New(goOptions)
 }
 
+// NewLimiterWithKeyTemplate creates limiter with request key composed from
+// key template e.g. "ip|route|header:X-API-Key", see limiter.ParseKeyTemplate
+func NewLimiterWithKeyTemplate(max int64, ttl time.Duration, tmpl string) (*limiter.Limiter, error) {
+	return NewLimiter(max, ttl).SetKeyTemplate(tmpl)
+}
+
 func ExpirableOptions(eo ...limiter.ExpirableOptions) []limiter.ExpirableOptions {
 	return eo
 }
@@ -36,25 +44,50 @@ func NewExpirableOption(max int64, ttl time.Duration, suffix string) limiter.Exp
 
 // BuildKeys generates a slice of keys to rate-limit by given limiter and request structs.
 func BuildKeys(lmt *limiter.Limiter, r *http.Request) *limiter.LimiterKeys {
-	remoteIP := libstring.RemoteIP(lmt.GetIPLookups(), 100, r)
+	remoteIP := lmt.KeyRemoteIP(r)
 	path := r.URL.Path
-	limiterKeys := &limiter.LimiterKeys{}
+	limiterKeys := &limiter.LimiterKeys{
+		Plan:   lmt.GetPlan(r),
+		Method: lmt.GetLimitedMethod(r),
+	}
 
 	userIdToLimit := ""
 	// Add to context if sid is set in request
 	// Authenticated requests can override global limits
 	if lmt.GetIncludeUserId() {
-		if userId, err := lmt.GetUserIdFromContext(r); err == nil {
+		if userId, err := lmt.GetUserId(r); err == nil {
 			userIdToLimit = userId
 		}
 	}
 
 	// Global limits are valid only for non loggedin requests
 	if len(userIdToLimit) == 0 {
-		limiterKeys.Global = []string{remoteIP}
+		limiterKeys.Global = []string{lmt.GetGlobalIPMask().Apply(remoteIP)}
+		limiterKeys.Pluggable = limiterKeys.Global
+	} else {
+		// Opt-in pluggable limits for loggedin requests, per user
+		if lmt.GetPluggableForAuthenticated() {
+			limiterKeys.Pluggable = []string{limiter.UserGlobalKeyPrefix, userIdToLimit}
+		}
+
+		// Opt-in global limits for loggedin requests, per user & per ip
+		if lmt.GetUserGlobalLimits() != nil {
+			limiterKeys.User = []string{limiter.UserGlobalKeyPrefix, userIdToLimit}
+		}
+		if lmt.GetAuthenticatedGlobalLimits() != nil && remoteIP != "" {
+			limiterKeys.AuthenticatedGlobal = []string{
+				limiter.AuthenticatedGlobalKeyPrefix, lmt.GetGlobalIPMask().Apply(remoteIP),
+			}
+		}
 	}
 
-	sliceKey := []string{remoteIP}
+	// Key extractors declare the exact dimensions to limit on
+	if lmt.HasKeyFuncs() {
+		limiterKeys.Request = lmt.BuildRequestKey(r)
+		return limiterKeys
+	}
+
+	sliceKey := []string{lmt.GetIPMask().Apply(remoteIP)}
 	if !lmt.GetIgnoreURL() {
 		sliceKey = append(sliceKey, path)
 	}
@@ -73,45 +106,205 @@ func BuildKeys(lmt *limiter.Limiter, r *http.Request) *limiter.LimiterKeys {
 }
 
 func ShouldSkipLimiter(lmt *limiter.Limiter, r *http.Request) bool {
+	// Allow listed requests bypass the limiter, unless deny listed
+	if lmt.IsAllowed(r) && !lmt.IsDenied(r) {
+		return true
+	}
+
+	if lmt.IsSkipped(r) {
+		return true
+	}
+
+	// If we are unable to find remoteIP or userId, skip limiter unless policy says otherwise
+	return !hasIdentity(lmt, r) && lmt.GetMissingIdentityPolicy() == limiter.MissingIdentitySkip
+}
+
+// hasIdentity validates if either remote ip or user id is present in request
+func hasIdentity(lmt *limiter.Limiter, r *http.Request) bool {
 	// Filter by remote ip
-	// If we are unable to find remoteIP, skip limiter
-	remoteIPPresent := libstring.RemoteIP(lmt.GetIPLookups(), 100, r) != ""
+	remoteIPPresent := lmt.RemoteIP(r) != ""
 
 	// Filter if token is present in context
 	userIdPresent := false
 	if lmt.GetIncludeUserId() {
-		if userId, err := lmt.GetUserIdFromContext(r); err == nil {
+		if userId, err := lmt.GetUserId(r); err == nil {
 			userIdPresent = userId != ""
 		}
 	}
 
-	return !remoteIPPresent && !userIdPresent
+	return remoteIPPresent || userIdPresent
 }
 
 // LimitByRequest builds keys based on http.Request struct,
 // loops through all the keys, and check if any one of them returns HTTPError.
 func LimitByRequest(lmt *limiter.Limiter, r *http.Request) (limiter.Context, error) {
-	var err error
-	var lmtCtx limiter.Context
+	lmtCtx, sliceKeys, skipped, err := limitByRequest(lmt, r)
+	lmtCtx.Policy = lmt.GetName()
+	// Rejections without consulting the store, e.g. by deny list, are shadowed as well
+	if lmt.GetShadow() {
+		lmtCtx = lmtCtx.Shadowed()
+	}
+	if !lmtCtx.Reached {
+		_, lmtCtx.Shadow = lmtCtx.ShadowTier()
+	}
+	notify(lmt, r, sliceKeys, lmtCtx, skipped, err)
+	logDecision(r, lmtCtx, err)
+	return lmtCtx, err
+}
+
+// logDecision logs rejections & failures of the request. Keys are hashed since
+// they carry ips & user ids, see hashKey.
+func logDecision(r *http.Request, lmtCtx limiter.Context, err error) {
+	logger := limiter.GetLogger()
+
+	if err != nil {
+		fields := []limiter.Field{limiter.F("policy", lmtCtx.Policy), limiter.F("path", r.URL.Path)}
+		var storeErr *limiter.StoreError
+		if errors.As(err, &storeErr) {
+			// Error of the store error carries the key, only the cause is logged
+			fields = append(fields, limiter.F("error", storeErr.Err), limiter.F("tier", storeErr.Tier),
+				limiter.F("key_hash", hashKey(storeErr.Key)), limiter.F("timeout", storeErr.Timeout()))
+			logger.Log(limiter.LevelError, "rate limit store failed", fields...)
+			return
+		}
+		logger.Log(limiter.LevelError, "rate limit failed", append(fields, limiter.F("error", err))...)
+		return
+	}
+
+	if lmtCtx.Shadow {
+		shadowTier, _ := lmtCtx.ShadowTier()
+		logger.Log(limiter.LevelInfo, "request rate limited in shadow mode",
+			limiter.F("policy", lmtCtx.Policy), limiter.F("tier", shadowTier.Tier), limiter.F("suffix", shadowTier.Suffix),
+			limiter.F("key_hash", hashKey(shadowTier.Key)), limiter.F("path", r.URL.Path))
+		return
+	}
+	if !lmtCtx.LimitReached() {
+		return
+	}
+	msg := "request rate limited"
+	if lmtCtx.Denied {
+		msg = "request denied"
+	}
+	logger.Log(limiter.LevelInfo, msg,
+		limiter.F("policy", lmtCtx.Policy), limiter.F("tier", lmtCtx.Tier), limiter.F("suffix", lmtCtx.Suffix),
+		limiter.F("key_hash", hashKey(lmtCtx.Key)), limiter.F("path", r.URL.Path), limiter.F("retry_after", lmtCtx.RetryAfter))
+}
+
+// hashKey returns short sha256 hash of the store key, so that rejections of the
+// same key can be correlated without logging the key
+func hashKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// notify observers of the limiter with the outcome of request
+func notify(lmt *limiter.Limiter, r *http.Request, sliceKeys *limiter.LimiterKeys,
+	lmtCtx limiter.Context, skipped bool, err error) {
+	for _, observer := range lmt.GetObservers() {
+		switch {
+		case skipped:
+			observer.OnSkip(r)
+		case err != nil:
+			observer.OnError(r, sliceKeys, err)
+		case lmtCtx.LimitReached():
+			observer.OnReject(r, sliceKeys, lmtCtx)
+		default:
+			observer.OnAllow(r, sliceKeys, lmtCtx)
+		}
+	}
+}
+
+// evaluatedTiers accumulates limit context of every tier evaluated for the request
+type evaluatedTiers []limiter.TierContext
+
+func (et *evaluatedTiers) add(lmtCtx limiter.Context, err error) (limiter.Context, error) {
+	*et = append(*et, lmtCtx.Tiers...)
+	lmtCtx.Tiers = *et
+	return lmtCtx, err
+}
+
+func limitByRequest(lmt *limiter.Limiter, r *http.Request) (
+	lmtCtx limiter.Context, sliceKeys *limiter.LimiterKeys, skipped bool, err error) {
+	// Deny listed requests are rejected before any call to the store
+	if lmt.IsDenied(r) {
+		return limiter.DeniedContext(limiter.TierDeny), nil, false, nil
+	}
 
 	shouldSkip := ShouldSkipLimiter(lmt, r)
 	if shouldSkip {
-		return lmtCtx, nil
+		return lmtCtx, nil, true, nil
 	}
 
-	sliceKeys := BuildKeys(lmt, r)
+	if lmt.GetMissingIdentityPolicy() == limiter.MissingIdentityReject && !hasIdentity(lmt, r) {
+		return limiter.DeniedContext(limiter.TierIdentity), nil, false, nil
+	}
+
+	sliceKeys = BuildKeys(lmt, r)
+	tiers := evaluatedTiers{}
+
+	if sliceKeys.IsPluggableValid() {
+		lmtCtx, err = tiers.add(sliceKeys.Pluggable.PluggableLimits(r.Context(), lmt))
+		if err != nil || lmtCtx.LimitReached() {
+			return lmtCtx, sliceKeys, false, err
+		}
+	}
 
 	if sliceKeys.IsGlobalValid() {
-		lmtCtx, err = sliceKeys.Global.PluggableLimits(r.Context(), lmt)
+		lmtCtx, err = tiers.add(sliceKeys.Global.GlobalLimits(r.Context(), lmt))
+		if err != nil || lmtCtx.LimitReached() {
+			return lmtCtx, sliceKeys, false, err
+		}
+	}
+
+	if sliceKeys.IsUserValid() {
+		lmtCtx, err = tiers.add(sliceKeys.User.UserGlobalLimits(r.Context(), lmt))
 		if err != nil || lmtCtx.LimitReached() {
-			return lmtCtx, err
+			return lmtCtx, sliceKeys, false, err
 		}
+	}
 
-		lmtCtx, err = sliceKeys.Global.GlobalLimits(r.Context(), lmt)
+	if sliceKeys.IsAuthenticatedGlobalValid() {
+		lmtCtx, err = tiers.add(sliceKeys.AuthenticatedGlobal.AuthenticatedGlobalLimits(r.Context(), lmt))
 		if err != nil || lmtCtx.LimitReached() {
-			return lmtCtx, err
+			return lmtCtx, sliceKeys, false, err
+		}
+	}
+
+	// Overrides of the identity take precedence over plan & method limits
+	// Failing lookups are treated as no override, so that the override store
+	// doesn't fail requests
+	override, lookupErr := lmt.LookupOverride(r)
+	if lookupErr != nil {
+		fields := []limiter.Field{limiter.F("policy", lmt.GetName()), limiter.F("error", lookupErr)}
+		var storeErr *limiter.StoreError
+		if errors.As(lookupErr, &storeErr) {
+			// Key of the store error carries the identities, see hashKey
+			fields = []limiter.Field{limiter.F("policy", lmt.GetName()), limiter.F("error", storeErr.Err),
+				limiter.F("key_hash", hashKey(storeErr.Key))}
 		}
+		limiter.GetLogger().Log(limiter.LevelWarn, "rate limit override lookup failed", fields...)
 	}
 
-	return sliceKeys.Request.Limits(r.Context(), lmt)
+	switch {
+	case override != nil:
+		lmtCtx, err = tiers.add(sliceKeys.Request.OverrideLimits(r.Context(), lmt, override, sliceKeys.Plan, sliceKeys.Method))
+	case sliceKeys.Plan == "" && sliceKeys.Method == "":
+		lmtCtx, err = tiers.add(sliceKeys.Request.Limits(r.Context(), lmt))
+	default:
+		// Both plan & method limits apply, counted independently
+		if sliceKeys.Plan != "" {
+			lmtCtx, err = tiers.add(sliceKeys.Request.PlanLimits(r.Context(), lmt, sliceKeys.Plan))
+			if err != nil || lmtCtx.LimitReached() {
+				return lmtCtx, sliceKeys, false, err
+			}
+		}
+		if sliceKeys.Method != "" {
+			lmtCtx, err = tiers.add(sliceKeys.Request.MethodLimits(r.Context(), lmt, sliceKeys.Method))
+			lmtCtx.Plan = sliceKeys.Plan
+		}
+	}
+	return lmtCtx, sliceKeys, false, err
 }
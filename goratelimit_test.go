@@ -1,8 +1,13 @@
 package goratelimit_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -10,15 +15,24 @@ import (
 
 	mockredis "github.com/alicebob/miniredis/v2"
 	goratelimit "github.com/alter123/go-ratelimit"
+	"github.com/alter123/go-ratelimit/libstring"
 	"github.com/alter123/go-ratelimit/limiter"
+	"github.com/alter123/go-ratelimit/metrics"
 	"github.com/redis/go-redis/v9"
 )
 
-const IPv6Addr = "2001:0db8:85a3:0000:0000:8a2e:0370:7334"
+const (
+	IPv6Addr = "2001:0db8:85a3:0000:0000:8a2e:0370:7334"
+	// Canonical form of IPv6Addr used in the keys
+	IPv6Key = "2001:db8:85a3::8a2e:370:7334"
+)
 
 var (
 	IsUserIdValid       = true
 	IsAdditionalContext = false
+
+	// Store of the limiters initialised by TestMain
+	mockStore *mockredis.Miniredis
 )
 
 func generateMockId(n int) string {
@@ -31,6 +45,32 @@ func generateMockId(n int) string {
 	return string(b)
 }
 
+// newRequest returns request of the method & path from the ip
+func newRequest(t *testing.T, method, path, ip string) *http.Request {
+	t.Helper()
+	r, err := http.NewRequest(method, path, strings.NewReader("!!!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "" {
+		r.Header.Set("CF-Connecting-IP", ip)
+	}
+	return r
+}
+
+// limitRequest limits the request by the limiter, failing the test on errors
+func limitRequest(t *testing.T, lmt *limiter.Limiter, r *http.Request) limiter.Context {
+	t.Helper()
+	lmtCtx, err := goratelimit.LimitByRequest(lmt, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lmtCtx
+}
+
+// Limiter created before Init, as package level limiters are
+var createdBeforeInit = goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false)
+
 func TestMain(m *testing.M) {
 	// create mock redis connection
 	s, err := mockredis.Run()
@@ -38,6 +78,7 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 	defer s.Close()
+	mockStore = s
 
 	// Initialise go-ratelimit
 	goratelimit.Init(limiter.LimiterOptions{
@@ -69,13 +110,7 @@ func TestSliceKeys(t *testing.T) {
 
 	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetGlobalLimits(1).
 		SetGlobalTtl(5 * time.Second)
-
-	r, err := http.NewRequest("GET", "/", strings.NewReader("!!!"))
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	r.Header.Set("CF-Connecting-IP", IPv6Addr)
+	r := newRequest(t, "GET", "/", IPv6Addr)
 
 	IsUserIdValid = false
 	sliceKeys := goratelimit.BuildKeys(lmt, r)
@@ -85,11 +120,11 @@ func TestSliceKeys(t *testing.T) {
 		t.Fatal("Length of sliceKeys is empty.")
 	}
 
-	if len(sliceKeys.Global) != 1 || sliceKeys.Global[0] != IPv6Addr {
+	if len(sliceKeys.Global) != 1 || sliceKeys.Global[0] != IPv6Key {
 		t.Fatal("Global key is not IPv6Addr.")
 	}
 
-	if len(sliceKeys.Request) != 5 || sliceKeys.Request[0] != IPv6Addr ||
+	if len(sliceKeys.Request) != 5 || sliceKeys.Request[0] != IPv6Key ||
 		sliceKeys.Request[1] != "/" || sliceKeys.Request[2] != "GET" {
 		t.Fatal("Request key is not IPv6Addr// /GET.")
 	}
@@ -98,20 +133,14 @@ func TestSliceKeys(t *testing.T) {
 func TestUserIdKeyLimit(t *testing.T) {
 	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetGlobalLimits(1).
 		SetGlobalTtl(5 * time.Second).SetIncludeUserId(true)
-
-	r, err := http.NewRequest("GET", "/", strings.NewReader("!!!"))
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	r.Header.Set("CF-Connecting-IP", IPv6Addr)
+	r := newRequest(t, "GET", "/", IPv6Addr)
 
 	sliceKeys := goratelimit.BuildKeys(lmt, r)
 	if len(sliceKeys.Global) != 0 {
 		t.Fatal("Global key is not empty.")
 	}
 
-	if len(sliceKeys.Request) != 5 || sliceKeys.Request[0] != IPv6Addr ||
+	if len(sliceKeys.Request) != 5 || sliceKeys.Request[0] != IPv6Key ||
 		sliceKeys.Request[1] != "/" || sliceKeys.Request[2] != "GET" ||
 		len(sliceKeys.Request[3]) != 24 {
 		t.Fatal("Request key is not IPv6Addr// /GET.")
@@ -119,31 +148,14 @@ func TestUserIdKeyLimit(t *testing.T) {
 }
 
 func TestGlobalLimits(t *testing.T) {
-	s, err := mockredis.Run()
-	if err != nil {
-		panic(err)
-	}
-	defer s.Close()
-
 	lmt := goratelimit.NewLimiter(2, 5*time.Second).SetIncludeUserId(false)
-	request := func() (limiter.Context, error) {
-		r, err := http.NewRequest("GET", "/", strings.NewReader("!!!"))
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		r.Header.Set("CF-Connecting-IP", IPv6Addr)
-		return goratelimit.LimitByRequest(lmt, r)
-	}
 
 	var lmtCtx limiter.Context
 
 	IsAdditionalContext = true
 
 	for i := 0; i < 60; i++ {
-		if lmtCtx, err = request(); err != nil {
-			t.Fatal(err)
-		}
+		lmtCtx = limitRequest(t, lmt, newRequest(t, "GET", "/", IPv6Addr))
 	}
 
 	// blocked for individual request
@@ -151,9 +163,7 @@ func TestGlobalLimits(t *testing.T) {
 		t.Fatal("Limit is not 1.")
 	}
 
-	if lmtCtx, err = request(); err != nil {
-		t.Fatal(err)
-	}
+	lmtCtx = limitRequest(t, lmt, newRequest(t, "GET", "/", IPv6Addr))
 	// should be blocked by global limiter
 	if lmtCtx.Limit != 60 || lmtCtx.Remaining != 0 || !lmtCtx.Reached || lmtCtx.Reset == 0 {
 		t.Fatal("Limit is not 60.")
@@ -168,15 +178,7 @@ func TestGlobalLimitsWithoutAdditionalContext(t *testing.T) {
 	var lmtCtx limiter.Context
 
 	for i := 0; i < 61; i++ {
-		r, err := http.NewRequest("GET", generateMockId(5), strings.NewReader("!!!"))
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		r.Header.Set("CF-Connecting-IP", IPv6Addr)
-		if lmtCtx, err = goratelimit.LimitByRequest(lmt, r); err != nil {
-			t.Fatal(err)
-		}
+		lmtCtx = limitRequest(t, lmt, newRequest(t, "GET", generateMockId(5), IPv6Addr))
 	}
 
 	if lmtCtx.Limit != 60 || lmtCtx.Remaining != 0 || !lmtCtx.Reached || lmtCtx.Reset == 0 {
@@ -188,18 +190,689 @@ func TestGlobalLimitsWithoutAdditionalContext(t *testing.T) {
 func TestIgnoredRequests(t *testing.T) {
 	lmt := goratelimit.NewLimiter(2, 5*time.Second).SetIncludeUserId(false)
 
-	r, err := http.NewRequest("GET", "/", strings.NewReader("!!!"))
+	lmtCtx := limitRequest(t, lmt, newRequest(t, "GET", "/", ""))
+	if lmtCtx.Limit != 0 || lmtCtx.Remaining != 0 || lmtCtx.Reached || lmtCtx.Reset != 0 {
+		t.Fatal("Limit is not 0.")
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetIncludeUserId(false).
+		SetKeyFuncs(limiter.KeyIP, limiter.KeyHeader("X-API-Key"), limiter.KeyQuery("tenant"))
+
+	r := newRequest(t, "POST", "/orders?tenant=acme", IPv6Addr)
+	r.Header.Set("X-API-Key", "key-1")
+
+	sliceKeys := goratelimit.BuildKeys(lmt, r)
+	if len(sliceKeys.Global) != 1 || sliceKeys.Global[0] != IPv6Key {
+		t.Fatal("Global key is not IPv6Addr.")
+	}
+
+	if len(sliceKeys.Request) != 3 || sliceKeys.Request[0] != IPv6Key ||
+		sliceKeys.Request[1] != "key-1" || sliceKeys.Request[2] != "acme" {
+		t.Fatalf("Request key is not IPv6Addr|key-1|acme: %v", sliceKeys.Request)
+	}
+}
+
+func TestKeyTemplate(t *testing.T) {
+	lmt, err := goratelimit.NewLimiterWithKeyTemplate(2, 5*time.Minute, "ip|route|header:X-API-Key|query:tenant")
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	r := newRequest(t, "GET", "/orders?tenant=acme", IPv6Addr)
+	r.Header.Set("X-API-Key", "key-1")
+
+	sliceKeys := goratelimit.BuildKeys(lmt, r)
+	if strings.Join(sliceKeys.Request, limiter.KeyJoinIdentifier) != IPv6Key+"|/orders|key-1|acme" {
+		t.Fatalf("Request key is not IPv6Addr|/orders|key-1|acme: %v", sliceKeys.Request)
+	}
+}
+
+func TestIdentitySources(t *testing.T) {
+	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetIdentitySources(
+		limiter.IdentityHeader("X-API-Key"),
+		limiter.HashIdentity(limiter.IdentityCookie("session")),
+	)
+
+	r := newRequest(t, "GET", "/", "")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s-1"})
+	userId, err := lmt.GetUserId(r)
+	if err != nil || len(userId) != 64 {
+		t.Fatalf("User id is not hashed session cookie: %q", userId)
+	}
+
+	// Header takes precedence over cookie
+	r.Header.Set("X-API-Key", "key-1")
+	if userId, err = lmt.GetUserId(r); err != nil || userId != "key-1" {
+		t.Fatalf("User id is not api key: %q", userId)
+	}
+
+	// Requests identified only by api key are not skipped
+	if goratelimit.ShouldSkipLimiter(lmt, r) {
+		t.Fatal("Request with api key is skipped.")
+	}
+
+	sliceKeys := goratelimit.BuildKeys(lmt, r)
+	if len(sliceKeys.Global) != 0 || sliceKeys.Request[3] != "key-1" {
+		t.Fatalf("Request key is not limited by api key: %v", sliceKeys.Request)
+	}
+}
+
+func TestIPNormalizationAndMask(t *testing.T) {
+	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetIncludeUserId(false).
+		SetIPMask(24, 64).SetGlobalIPMask(16, 48).
+		SetIPLookups([]string{"X-Real-IP", "CF-Connecting-IP", "RemoteAddr"})
+
+	// Garbage is ignored, IPv4-mapped IPv6 with port is normalized
+	r := newRequest(t, "GET", "/", "[::ffff:203.0.113.9]:443")
+	r.Header.Set("X-Real-IP", "not-an-ip")
+	if ip := lmt.RemoteIP(r); ip != "203.0.113.9" {
+		t.Fatalf("Remote ip is not normalized: %q", ip)
+	}
+
+	sliceKeys := goratelimit.BuildKeys(lmt, r)
+	if sliceKeys.Global[0] != "203.0.0.0/16" || sliceKeys.Request[0] != "203.0.113.0/24" {
+		t.Fatalf("IPv4 keys are not masked: %v %v", sliceKeys.Global, sliceKeys.Request)
+	}
+
+	r.Header.Set("CF-Connecting-IP", "fe80::1:2:3:4%eth0")
+	sliceKeys = goratelimit.BuildKeys(lmt, r)
+	if sliceKeys.Global[0] != "fe80::/48" || sliceKeys.Request[0] != "fe80::/64" {
+		t.Fatalf("IPv6 keys are not masked: %v %v", sliceKeys.Global, sliceKeys.Request)
+	}
+}
+
+func TestAllowAndDenyLists(t *testing.T) {
+	allowed, err := libstring.ParseCIDRs("10.0.0.0/8", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied, err := libstring.ParseCIDRs("10.6.6.0/24", "198.51.100.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).
+		SetAllowList(allowed).SetDenyList(denied).SetIPLookups([]string{"RemoteAddr"})
+
+	request := func(remoteAddr string) limiter.Context {
+		r := newRequest(t, "GET", "/", "")
+		r.RemoteAddr = remoteAddr
+		return limitRequest(t, lmt, r)
+	}
+
+	for i := 0; i < 3; i++ {
+		if lmtCtx := request("10.1.2.3:80"); lmtCtx.Reached || lmtCtx.Limit != 0 {
+			t.Fatal("Allow listed ip is limited.")
+		}
+		if lmtCtx := request("[2001:db8:1::1]:80"); lmtCtx.Reached || lmtCtx.Limit != 0 {
+			t.Fatal("Allow listed network is limited.")
+		}
+	}
+
+	// Deny list takes precedence over allow list
+	for _, remoteAddr := range []string{"10.6.6.6:80", "198.51.100.7:80"} {
+		if lmtCtx := request(remoteAddr); !lmtCtx.Reached || !lmtCtx.Denied {
+			t.Fatalf("Deny listed ip %s is not denied.", remoteAddr)
+		}
+	}
+
+	if lmtCtx := request("203.0.113.9:80"); lmtCtx.Reached || lmtCtx.Denied || lmtCtx.Limit != 1 {
+		t.Fatal("Request is not limited.")
+	}
+}
+
+func TestSkippersAndMissingIdentity(t *testing.T) {
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).
+		SetSkippers(limiter.SkipPaths("/healthz"), limiter.SkipMethods("options"))
+
+	if !goratelimit.ShouldSkipLimiter(lmt, newRequest(t, "GET", "/healthz", "203.0.113.10")) ||
+		!goratelimit.ShouldSkipLimiter(lmt, newRequest(t, "OPTIONS", "/orders", "203.0.113.10")) {
+		t.Fatal("Request matching skipper is not skipped.")
+	}
+	if goratelimit.ShouldSkipLimiter(lmt, newRequest(t, "GET", "/orders", "203.0.113.10")) {
+		t.Fatal("Request is skipped.")
+	}
+
+	anonymous := newRequest(t, "GET", "/anonymous", "")
+
+	lmt.SetMissingIdentityPolicy(limiter.MissingIdentityReject)
+	if lmtCtx, err := goratelimit.LimitByRequest(lmt, anonymous); err != nil || !lmtCtx.Denied {
+		t.Fatal("Request without identity is not rejected.")
+	}
+
+	lmt.SetMissingIdentityPolicy(limiter.MissingIdentityFallback).SetMissingIdentityKey("shared")
+	if sliceKeys := goratelimit.BuildKeys(lmt, anonymous); sliceKeys.Global[0] != "shared" ||
+		sliceKeys.Request[0] != "shared" {
+		t.Fatalf("Request without identity is not limited by fallback key: %v", sliceKeys.Request)
+	}
+
 	var lmtCtx limiter.Context
-	lmtCtx, err = goratelimit.LimitByRequest(lmt, r)
+	for i := 0; i < 2; i++ {
+		lmtCtx = limitRequest(t, lmt, anonymous)
+	}
+	if !lmtCtx.Reached || lmtCtx.Denied || lmtCtx.Limit != 1 {
+		t.Fatal("Requests without identity are not limited under fallback key.")
+	}
+}
+
+func TestPlanLimits(t *testing.T) {
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).
+		SetIdentitySources(limiter.IdentityHeader("X-API-Key")).
+		SetPlans(map[string]limiter.ExpirableOptions{
+			"pro": goratelimit.NewExpirableOption(3, 5*time.Minute, ""),
+		}).
+		SetPlanResolver(func(_ *http.Request, userId string) (string, error) {
+			if strings.HasPrefix(userId, "pro-") {
+				return "pro", nil
+			}
+			return "free", nil
+		})
+
+	request := func(apiKey string) limiter.Context {
+		r := newRequest(t, "GET", "/plans", "203.0.113.11")
+		r.Header.Set("X-API-Key", apiKey)
+		return limitRequest(t, lmt, r)
+	}
+
+	var lmtCtx limiter.Context
+	for i := 0; i < 3; i++ {
+		lmtCtx = request("pro-1")
+	}
+	if lmtCtx.Reached || lmtCtx.Limit != 3 || lmtCtx.Plan != "pro" {
+		t.Fatalf("Request is not limited by pro plan: %+v", lmtCtx)
+	}
+
+	// Unknown plans are limited by default limits
+	if lmtCtx = request("free-1"); lmtCtx.Limit != 1 || lmtCtx.Plan != "" {
+		t.Fatalf("Request is not limited by default limits: %+v", lmtCtx)
+	}
+}
+
+func TestReloadableLimiter(t *testing.T) {
+	rl := limiter.NewReloadable(goratelimit.NewLimiter(5, 5*time.Minute).SetIncludeUserId(false))
+
+	request := func() limiter.Context {
+		return limitRequest(t, rl.Load(), newRequest(t, "GET", "/reloadable", "203.0.113.12"))
+	}
+
+	previous := rl.Load()
+	for i := 0; i < 2; i++ {
+		request()
+	}
+
+	// Tightened limits apply on the existing counters
+	rl.Update(func(l *limiter.Limiter) {
+		l.SetLimits(2)
+	})
+	if previous.GetLimits() != 5 {
+		t.Fatal("Previous limiter is modified.")
+	}
+	if lmtCtx := request(); !lmtCtx.Reached || lmtCtx.Limit != 2 {
+		t.Fatalf("Tightened limits are not applied: %+v", lmtCtx)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	lmt, err := goratelimit.NewLimiter(5, 5*time.Minute).SetIncludeUserId(false).
+		SetGlobalLimits(1).SetGlobalTtl(time.Minute).SetMethods([]string{"post"}).Build()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if lmtCtx.Limit != 0 || lmtCtx.Remaining != 0 || lmtCtx.Reached || lmtCtx.Reset != 0 {
-		t.Fatal("Limit is not 0.")
+	var lmtCtx limiter.Context
+	for i := 0; i < 2; i++ {
+		lmtCtx = limitRequest(t, lmt, newRequest(t, "POST", "/build", "203.0.113.13"))
+	}
+
+	// Global limits set after New are enforced
+	if !lmtCtx.Reached || lmtCtx.Limit != 1 {
+		t.Fatalf("Global limits are not applied: %+v", lmtCtx)
+	}
+}
+
+func TestBuildAfterInit(t *testing.T) {
+	lmt, err := createdBeforeInit.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lmtCtx limiter.Context
+	for i := 0; i < 2; i++ {
+		lmtCtx = limitRequest(t, lmt, newRequest(t, "GET", "/created-before-init", "203.0.113.29"))
+	}
+	if !lmtCtx.Reached || lmtCtx.Tier != limiter.TierRequest || lmtCtx.Limit != 1 {
+		t.Fatalf("Limiter created before Init is not enforced: %+v", lmtCtx)
+	}
+}
+
+func TestMethodLimits(t *testing.T) {
+	lmt := goratelimit.NewLimiter(3, 5*time.Minute).SetIncludeUserId(false).
+		SetKeyFuncs(limiter.KeyIP, limiter.KeyPath).
+		SetMethodLimits(map[string]limiter.ExpirableOptions{
+			"post": goratelimit.NewExpirableOption(1, 5*time.Minute, ""),
+		})
+
+	request := func(method string) limiter.Context {
+		return limitRequest(t, lmt, newRequest(t, method, "/resources", "203.0.113.14"))
+	}
+
+	request("POST")
+	if lmtCtx := request("POST"); !lmtCtx.Reached || lmtCtx.Limit != 1 {
+		t.Fatalf("Writes are not limited by method limits: %+v", lmtCtx)
+	}
+
+	// Reads are limited independently by default limits
+	if lmtCtx := request("GET"); lmtCtx.Reached || lmtCtx.Limit != 3 || lmtCtx.Remaining != 2 {
+		t.Fatalf("Reads are not limited by default limits: %+v", lmtCtx)
+	}
+}
+
+func TestPlanAndMethodLimits(t *testing.T) {
+	// Plan named after the method is counted independently
+	lmt := goratelimit.NewLimiter(10, 5*time.Minute).
+		SetIdentitySources(limiter.IdentityHeader("X-API-Key")).
+		SetPlans(map[string]limiter.ExpirableOptions{
+			"POST": goratelimit.NewExpirableOption(3, 5*time.Minute, ""),
+		}).
+		SetPlanResolver(func(_ *http.Request, _ string) (string, error) { return "POST", nil }).
+		SetMethodLimits(map[string]limiter.ExpirableOptions{
+			"POST": goratelimit.NewExpirableOption(2, 5*time.Minute, ""),
+		})
+
+	var lmtCtx limiter.Context
+	for i := 0; i < 3; i++ {
+		r := newRequest(t, "POST", "/plan-and-method", "203.0.113.25")
+		r.Header.Set("X-API-Key", "user-25")
+		lmtCtx = limitRequest(t, lmt, r)
+	}
+
+	if !lmtCtx.Reached || lmtCtx.Tier != limiter.TierMethod || lmtCtx.Plan != "POST" || len(lmtCtx.Tiers) != 2 {
+		t.Fatalf("Request is not limited by method limits: %+v", lmtCtx)
+	}
+	plan := lmtCtx.Tiers[0]
+	if plan.Tier != limiter.TierPlan || plan.Reached || plan.Remaining != 0 || plan.Key == lmtCtx.Key {
+		t.Fatalf("Plan limits are not evaluated independently: %+v", plan)
+	}
+}
+
+func TestAuthenticatedGlobalLimits(t *testing.T) {
+	lmt := goratelimit.NewLimiter(10, 5*time.Minute).
+		SetIdentitySources(limiter.IdentityHeader("X-API-Key")).
+		SetUserGlobalLimits(goratelimit.NewExpirableOption(2, 5*time.Minute, "")).
+		SetAuthenticatedGlobalLimits(goratelimit.NewExpirableOption(3, 5*time.Minute, ""))
+
+	request := func(apiKey string) limiter.Context {
+		r := newRequest(t, "GET", generateMockId(5), "203.0.113.15")
+		r.Header.Set("X-API-Key", apiKey)
+
+		if sliceKeys := goratelimit.BuildKeys(lmt, r); len(sliceKeys.Global) != 0 ||
+			strings.Join(sliceKeys.User, limiter.KeyJoinIdentifier) != "user|"+apiKey ||
+			strings.Join(sliceKeys.AuthenticatedGlobal, limiter.KeyJoinIdentifier) != "authenticated|203.0.113.15" {
+			t.Fatalf("Global keys of authenticated request are invalid: %+v", sliceKeys)
+		}
+		return limitRequest(t, lmt, r)
+	}
+
+	// Limited per user across all the routes
+	request("user-1")
+	request("user-1")
+	if lmtCtx := request("user-1"); !lmtCtx.Reached || lmtCtx.Limit != 2 {
+		t.Fatalf("User global limits are not applied: %+v", lmtCtx)
+	}
+
+	// Limited per ip across all the users
+	request("user-2")
+	if lmtCtx := request("user-3"); !lmtCtx.Reached || lmtCtx.Limit != 3 {
+		t.Fatalf("Authenticated global limits are not applied: %+v", lmtCtx)
+	}
+}
+
+func TestPluggableLimitsOfAuthenticatedRequests(t *testing.T) {
+	lmt := goratelimit.NewLimiter(10, 5*time.Minute).
+		SetIdentitySources(limiter.IdentityHeader("X-API-Key")).
+		SetPluggableLimiter(goratelimit.ExpirableOptions(goratelimit.NewExpirableOption(1, time.Minute, "burst")))
+
+	request := func(apiKey string) limiter.Context {
+		r := newRequest(t, "GET", "/burst", "203.0.113.26")
+		r.Header.Set("X-API-Key", apiKey)
+		return limitRequest(t, lmt, r)
+	}
+
+	// Authenticated requests are not limited by pluggable limits by default
+	request("user-1")
+	if lmtCtx := request("user-1"); lmtCtx.Reached || len(lmtCtx.Tiers) != 1 || lmtCtx.Tier != limiter.TierRequest {
+		t.Fatalf("Pluggable limits are applied to authenticated requests: %+v", lmtCtx)
+	}
+
+	// Limited per user, not per ip
+	lmt.SetPluggableForAuthenticated(true)
+	request("user-1")
+	if lmtCtx := request("user-1"); !lmtCtx.Reached || lmtCtx.Tier != limiter.TierPluggable || lmtCtx.Key != "user|user-1|burst" {
+		t.Fatalf("Pluggable limits are not applied to authenticated requests: %+v", lmtCtx)
+	}
+	if lmtCtx := request("user-2"); lmtCtx.Reached {
+		t.Fatalf("Pluggable limits are shared across the users: %+v", lmtCtx)
+	}
+}
+
+func TestDecisionMetadata(t *testing.T) {
+	lmt := goratelimit.NewLimiter(5, 5*time.Minute).SetIncludeUserId(false).SetName("search").
+		SetKeyFuncs(limiter.KeyIP, limiter.KeyPath).
+		SetPluggableLimiter(goratelimit.ExpirableOptions(
+			goratelimit.NewExpirableOption(3, time.Minute, "minute"),
+			goratelimit.NewExpirableOption(1, time.Minute, "burst"),
+		))
+
+	request := func() limiter.Context {
+		return limitRequest(t, lmt, newRequest(t, "GET", "/search", "203.0.113.16"))
+	}
+
+	lmtCtx := request()
+	if lmtCtx.Tier != limiter.TierRequest || lmtCtx.Key != "203.0.113.16|/search" ||
+		lmtCtx.Policy != "search" || lmtCtx.RetryAfter != 0 || lmtCtx.ResetAt.IsZero() {
+		t.Fatalf("Request tier decision is invalid: %+v", lmtCtx)
+	}
+	if len(lmtCtx.Tiers) != 4 || lmtCtx.Tiers[0].Suffix != "minute" || lmtCtx.Tiers[2].Tier != limiter.TierGlobal {
+		t.Fatalf("Tiers breakdown is invalid: %+v", lmtCtx.Tiers)
+	}
+
+	lmtCtx = request()
+	if !lmtCtx.Reached || lmtCtx.Tier != limiter.TierPluggable || lmtCtx.Suffix != "burst" ||
+		lmtCtx.Key != "203.0.113.16|burst" || lmtCtx.RetryAfter <= 0 || lmtCtx.RetryAfter > time.Minute {
+		t.Fatalf("Pluggable tier decision is invalid: %+v", lmtCtx)
+	}
+	if len(lmtCtx.Tiers) != 2 || lmtCtx.Tiers[0].Reached || !lmtCtx.Tiers[1].Reached {
+		t.Fatalf("Tiers breakdown is invalid: %+v", lmtCtx.Tiers)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false)
+
+	var lmtCtx limiter.Context
+	for i := 0; i < 2; i++ {
+		lmtCtx = limitRequest(t, lmt, newRequest(t, "GET", "/errors", "203.0.113.17"))
+	}
+
+	var exceeded *limiter.LimitExceededError
+	if err := lmtCtx.Err(); !errors.Is(err, limiter.ErrLimitExceeded) || !errors.As(err, &exceeded) ||
+		exceeded.Context.Tier != limiter.TierRequest {
+		t.Fatalf("Limit exceeded error is invalid: %v", err)
+	}
+}
+
+func TestObservers(t *testing.T) {
+	outcomes := map[string]int{}
+	var rejectedKeys *limiter.LimiterKeys
+
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).
+		SetSkippers(limiter.SkipPaths("/healthz")).
+		AddObserver(limiter.ObserverFuncs{
+			Allow: func(_ *http.Request, _ *limiter.LimiterKeys, _ limiter.Context) { outcomes["allow"]++ },
+			Reject: func(_ *http.Request, keys *limiter.LimiterKeys, _ limiter.Context) {
+				outcomes["reject"]++
+				rejectedKeys = keys
+			},
+			Skip: func(_ *http.Request) { outcomes["skip"]++ },
+		})
+
+	for _, path := range []string{"/observed", "/observed", "/healthz"} {
+		limitRequest(t, lmt, newRequest(t, "GET", path, "203.0.113.18"))
+	}
+
+	if outcomes["allow"] != 1 || outcomes["reject"] != 1 || outcomes["skip"] != 1 {
+		t.Fatalf("Observers are not notified: %v", outcomes)
+	}
+	if rejectedKeys == nil || rejectedKeys.Request[1] != "/observed" {
+		t.Fatalf("Keys are not passed to observers: %+v", rejectedKeys)
+	}
+}
+
+func TestInstrumentedLimiter(t *testing.T) {
+	collector := metrics.NewCollector()
+	lmt := collector.Instrument(goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).
+		SetName("metered").SetSkippers(limiter.SkipPaths("/healthz")))
+
+	for _, path := range []string{"/metered", "/metered", "/healthz"} {
+		limitRequest(t, lmt, newRequest(t, "GET", path, "203.0.113.19"))
+	}
+
+	if collector.Decisions("metered", limiter.TierRequest, metrics.OutcomeAllowed) != 1 ||
+		collector.Decisions("metered", limiter.TierRequest, metrics.OutcomeRejected) != 1 ||
+		collector.Decisions("metered", "", metrics.OutcomeSkipped) != 1 {
+		t.Fatalf("Decisions are not recorded: %v", collector.Snapshot())
+	}
+	// Global & request tiers are called for both limited requests
+	if collector.StoreCalls("metered", limiter.TierRequest, metrics.ResultOK) != 2 ||
+		collector.StoreCalls("metered", limiter.TierGlobal, metrics.ResultOK) != 2 {
+		t.Fatalf("Store calls are not recorded: %v", collector.Snapshot())
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	limiter.SetLogger(limiter.NewJSONLogger(&buf, limiter.LevelInfo))
+	defer limiter.SetLogger(nil)
+
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).SetName("logged")
+	for i := 0; i < 2; i++ {
+		limitRequest(t, lmt, newRequest(t, "GET", "/logged", "203.0.113.20"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"msg":"request rate limited"`) ||
+		!strings.Contains(lines[0], `"policy":"logged"`) || !strings.Contains(lines[0], `"tier":"request"`) {
+		t.Fatalf("Rejection is not logged: %s", buf.String())
+	}
+	// Keys carry ips & user ids, only their hashes are logged
+	if strings.Contains(lines[0], "203.0.113.20") || !strings.Contains(lines[0], `"key_hash":"`) {
+		t.Fatalf("Key of rejection is logged: %s", lines[0])
+	}
+
+	buf.Reset()
+	mockStore.SetError("store unavailable")
+	_, err := goratelimit.LimitByRequest(lmt, newRequest(t, "GET", "/logged", "203.0.113.20"))
+	mockStore.SetError("")
+	if err == nil {
+		t.Fatal("Store failure is not returned.")
+	}
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"msg":"rate limit store failed"`) ||
+		!strings.Contains(lines[0], "store unavailable") {
+		t.Fatalf("Store failure is not logged: %s", buf.String())
+	}
+	if strings.Contains(lines[0], "203.0.113.20") || !strings.Contains(lines[0], `"key_hash":"`) {
+		t.Fatalf("Key of store failure is logged: %s", lines[0])
+	}
+}
+
+func TestShadowMode(t *testing.T) {
+	burst := goratelimit.NewExpirableOption(1, 5*time.Minute, "burst")
+	burst.Shadow = true
+
+	for name, tc := range map[string]struct {
+		lmt          *limiter.Limiter
+		ip, tier     string
+		shadowSuffix string
+	}{
+		"limiter": {
+			lmt:  goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).SetShadow(true),
+			ip:   "203.0.113.21",
+			tier: limiter.TierRequest,
+		},
+		"pluggable": {
+			lmt: goratelimit.NewLimiter(10, 5*time.Minute).SetIncludeUserId(false).
+				SetPluggableLimiter([]limiter.ExpirableOptions{burst}),
+			ip:           "203.0.113.22",
+			tier:         limiter.TierPluggable,
+			shadowSuffix: "burst",
+		},
+	} {
+		var lmtCtx limiter.Context
+		for i := 0; i < 2; i++ {
+			lmtCtx = limitRequest(t, tc.lmt, newRequest(t, "GET", "/shadow", tc.ip))
+		}
+
+		shadowTier, ok := lmtCtx.ShadowTier()
+		if lmtCtx.Reached || !lmtCtx.Shadow || !ok || shadowTier.Tier != tc.tier ||
+			shadowTier.Suffix != tc.shadowSuffix || !shadowTier.Reached {
+			t.Fatalf("%s: Request is not allowed in shadow mode: %+v", name, lmtCtx)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	lmt := goratelimit.NewLimiter(1, 5*time.Minute).SetIncludeUserId(false).SetName("explained")
+
+	r := newRequest(t, "GET", "/explained", "203.0.113.23")
+	e, err := goratelimit.Explain(lmt, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Decision != goratelimit.DecisionAllow || e.IP != "203.0.113.23" || e.IPLookup != "CF-Connecting-IP" ||
+		len(e.Tiers) != 2 || e.Tiers[1].Tier != limiter.TierRequest || e.Tiers[1].Remaining != 1 {
+		t.Fatalf("Request is not explained: %+v", e)
+	}
+
+	// Explain doesn't consume quota, the request is still allowed
+	if lmtCtx := limitRequest(t, lmt, r); lmtCtx.Reached {
+		t.Fatalf("Quota is consumed by explain: %+v", lmtCtx)
+	}
+
+	handler := goratelimit.ExplainHandler(func(_ *http.Request) *limiter.Limiter { return lmt })
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET",
+		"/explain?path=/explained&header=CF-Connecting-IP:+203.0.113.23", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Explain handler failed: %d %s", w.Code, w.Body.String())
+	}
+
+	if err = json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Decision != goratelimit.DecisionReject || e.DecidingTier == nil ||
+		e.DecidingTier.Tier != limiter.TierRequest || e.DecidingTier.Remaining != 0 {
+		t.Fatalf("Rejection is not explained: %s", w.Body.String())
+	}
+}
+
+func TestExplainShadowTier(t *testing.T) {
+	burst := goratelimit.NewExpirableOption(1, 5*time.Minute, "burst")
+	burst.Shadow = true
+	lmt := goratelimit.NewLimiter(5, 5*time.Minute).SetIncludeUserId(false).
+		SetPluggableLimiter([]limiter.ExpirableOptions{burst})
+
+	r := newRequest(t, "GET", "/explained-shadow", "203.0.113.27")
+	limitRequest(t, lmt, r)
+
+	// Reached shadow tier doesn't reject the request
+	e, err := goratelimit.Explain(lmt, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Decision != goratelimit.DecisionAllow || e.DecidingTier == nil ||
+		e.DecidingTier.Tier != limiter.TierPluggable || !e.DecidingTier.Shadow || len(e.Tiers) != 3 {
+		t.Fatalf("Shadow tier is not explained: %+v", e)
+	}
+}
+
+func TestSharedOverrides(t *testing.T) {
+	// Overrides set by an instance are consulted by the others sharing the store
+	overrides, err := limiter.NewStoreOverrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := limiter.NewStoreOverrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Revocations by the other instance would otherwise wait for cached lookups to expire
+	shared.SetCacheTTL(0)
+	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetIncludeUserId(false).SetName("overridden").
+		SetOverrides(shared)
+
+	ctx := context.Background()
+	if err = overrides.Set(ctx, limiter.MultiplierOverride("overridden", "203.0.113.24", 2, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err = overrides.Set(ctx, limiter.Override{Identity: "203.0.113.24", Limit: 1, Period: time.Minute}); !errors.Is(err, limiter.ErrInvalidConfig) {
+		t.Fatalf("Override without expiry is set: %v", err)
+	}
+
+	limit := func(path string) limiter.Context {
+		return limitRequest(t, lmt, newRequest(t, "GET", path, "203.0.113.24"))
+	}
+
+	// Override scales the request limits it replaces, per path
+	for _, path := range []string{"/overridden", "/overridden/other"} {
+		for i := 0; i < 4; i++ {
+			if lmtCtx := limit(path); lmtCtx.Reached || lmtCtx.Tier != limiter.TierOverride || lmtCtx.Limit != 4 {
+				t.Fatalf("Override is not applied on %s: %+v", path, lmtCtx)
+			}
+		}
+		if lmtCtx := limit(path); !lmtCtx.Reached || lmtCtx.Tier != limiter.TierOverride ||
+			lmtCtx.Key != "203.0.113.24|"+path+"|GET|||override" {
+			t.Fatalf("Override limits are not enforced on %s: %+v", path, lmtCtx)
+		}
+	}
+
+	listed, err := shared.List(ctx, "overridden")
+	if err != nil || len(listed) != 1 || listed[0].Multiplier != 2 {
+		t.Fatalf("Overrides are not listed: %+v, %v", listed, err)
+	}
+
+	if err = overrides.Delete(ctx, "overridden", "203.0.113.24"); err != nil {
+		t.Fatal(err)
+	}
+	if lmtCtx := limit("/overridden"); lmtCtx.Tier != limiter.TierRequest {
+		t.Fatalf("Revoked override is applied: %+v", lmtCtx)
+	}
+}
+
+func TestOverridesOfUnnamedLimiters(t *testing.T) {
+	// Overrides on all the policies are counted per limiter & route
+	overrides := limiter.NewMemoryOverrideStore()
+	if err := overrides.Set(context.Background(),
+		limiter.AbsoluteOverride("", "203.0.113.30", 1, time.Minute, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/unnamed", "/unnamed/other"} {
+		lmt := goratelimit.NewLimiter(5, 5*time.Minute).SetIncludeUserId(false).SetOverrides(overrides)
+		if lmtCtx := limitRequest(t, lmt, newRequest(t, "GET", path, "203.0.113.30")); lmtCtx.Reached ||
+			lmtCtx.Tier != limiter.TierOverride {
+			t.Fatalf("Override counter is shared across the routes: %+v", lmtCtx)
+		}
+		if lmtCtx := limitRequest(t, lmt, newRequest(t, "GET", path, "203.0.113.30")); !lmtCtx.Reached {
+			t.Fatalf("Override limits are not enforced on %s: %+v", path, lmtCtx)
+		}
+	}
+}
+
+func TestUnavailableOverrides(t *testing.T) {
+	// Failing lookups of overrides don't fail the requests
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+
+	lmt := goratelimit.NewLimiter(2, 5*time.Minute).SetIncludeUserId(false).SetName("unavailable").
+		SetOverrides(limiter.NewRedisOverrideStore(client, "unavailable"))
+
+	var buf bytes.Buffer
+	limiter.SetLogger(limiter.NewJSONLogger(&buf, limiter.LevelWarn))
+	defer limiter.SetLogger(nil)
+
+	r := newRequest(t, "GET", "/unavailable", "203.0.113.28")
+	lmtCtx, err := goratelimit.LimitByRequest(lmt, r)
+	if err != nil || lmtCtx.Reached || lmtCtx.Tier != limiter.TierRequest {
+		t.Fatalf("Request is failed by the override store: %+v, %v", lmtCtx, err)
+	}
+
+	// Failures are logged without the identities
+	if !strings.Contains(buf.String(), `"msg":"rate limit override lookup failed"`) ||
+		strings.Contains(buf.String(), "203.0.113.28") {
+		t.Fatalf("Failing lookup is not logged: %s", buf.String())
 	}
 }
@@ -2,49 +2,276 @@
 package libstring
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
 )
 
+// IPLookup is a place to look up IP address, either "RemoteAddr",
+// "X-Forwarded-For", "Forwarded" (RFC 7239) or any header carrying single
+// IP address such as "CF-Connecting-IP", "X-Real-IP" or "True-Client-IP"
+type IPLookup struct {
+	Name string
+
+	// Proxies trusted to set the header, overrides IPOptions.TrustedProxies if set
+	TrustedProxies []*net.IPNet
+}
+
+// IPLookups creates lookups by names, which rely on IPOptions.TrustedProxies
+func IPLookups(names ...string) []IPLookup {
+	lookups := make([]IPLookup, len(names))
+	for i, name := range names {
+		lookups[i] = IPLookup{Name: name}
+	}
+	return lookups
+}
+
+// IPOptions are options to find IP Address of the request
+type IPOptions struct {
+	// List of places to look up IP address, in the order of precedence
+	Lookups []IPLookup
+
+	// Forwarded headers are honoured only when RemoteAddr is a trusted proxy,
+	// empty list trusts forwarded headers from anyone
+	TrustedProxies []*net.IPNet
+
+	// Index of forwarded address from behind, used when no proxies are trusted
+	ForwardedForIndexFromBehind int
+}
+
 // RemoteIP finds IP Address given http.Request struct
 func RemoteIP(ipLookups []string, forwardedForIndexFromBehind int, r *http.Request) string {
-	cfConnectingIP := r.Header.Get("CF-Connecting-IP")
-	realIP := r.Header.Get("X-Real-IP")
-	forwardedFor := r.Header.Get("X-Forwarded-For")
+	ip, _ := RemoteIPWithOptions(IPOptions{
+		Lookups:                     IPLookups(ipLookups...),
+		ForwardedForIndexFromBehind: forwardedForIndexFromBehind,
+	}, r)
+	return ip
+}
+
+// RemoteIPWithOptions finds IP Address given http.Request struct,
+// along with the name of lookup from which IP Address was found
+func RemoteIPWithOptions(opts IPOptions, r *http.Request) (string, string) {
+	remoteIP := remoteAddrIP(r)
 
-	for _, lookup := range ipLookups {
-		if lookup == "CF-Connecting-IP" && cfConnectingIP != "" {
-			return cfConnectingIP
+	for _, lookup := range opts.Lookups {
+		if strings.EqualFold(lookup.Name, "RemoteAddr") {
+			return NormalizeIP(remoteIP), lookup.Name
 		}
 
-		if lookup == "RemoteAddr" {
-			// 1. Cover the basic use cases for both ipv4 and ipv6
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				// 2. Upon error, just return the remote addr.
-				return r.RemoteAddr
-			}
-			return ip
+		trustedProxies := opts.TrustedProxies
+		if lookup.TrustedProxies != nil {
+			trustedProxies = lookup.TrustedProxies
+		}
+
+		// Forwarded headers can be spoofed by the client unless sent by trusted proxy
+		if len(trustedProxies) > 0 && !IsTrustedProxy(remoteIP, trustedProxies) {
+			continue
 		}
-		if lookup == "X-Forwarded-For" && forwardedFor != "" {
-			// X-Forwarded-For is potentially a list of addresses separated with ","
-			parts := strings.Split(forwardedFor, ",")
-			for i, p := range parts {
-				parts[i] = strings.TrimSpace(p)
+
+		var ip string
+		var malformed bool
+		switch {
+		case strings.EqualFold(lookup.Name, "X-Forwarded-For"):
+			ip, malformed = forwardedForIP(forwardedForChain(r), trustedProxies, opts.ForwardedForIndexFromBehind)
+		case strings.EqualFold(lookup.Name, "Forwarded"):
+			ip, malformed = forwardedForIP(forwardedChain(r), trustedProxies, opts.ForwardedForIndexFromBehind)
+		default:
+			ip = r.Header.Get(lookup.Name)
+		}
+
+		// Addresses past an invalid hop are set by the client, fallback on the peer
+		if malformed {
+			return NormalizeIP(remoteIP), "RemoteAddr"
+		}
+
+		// Invalid addresses are ignored to fallback on next lookup
+		if ip = NormalizeIP(ip); ip != "" {
+			return ip, lookup.Name
+		}
+	}
+
+	return "", ""
+}
+
+func remoteAddrIP(r *http.Request) string {
+	// 1. Cover the basic use cases for both ipv4 and ipv6
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// 2. Upon error, just return the remote addr.
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// forwardedForChain parses X-Forwarded-For, potentially a list of addresses separated with ","
+func forwardedForChain(r *http.Request) []string {
+	var chain []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, p := range strings.Split(value, ",") {
+			chain = append(chain, NormalizeIP(p))
+		}
+	}
+	return chain
+}
+
+// forwardedChain parses "for" parameters of RFC 7239 Forwarded header, e.g.
+// for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711". Obfuscated
+// identifiers & "unknown" are not addresses and are added as empty nodes.
+func forwardedChain(r *http.Request) []string {
+	var chain []string
+	for _, value := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				i := strings.Index(pair, "=")
+				if i < 0 || !strings.EqualFold(strings.TrimSpace(pair[:i]), "for") {
+					continue
+				}
+				chain = append(chain, forwardedNodeIP(pair[i+1:]))
 			}
+		}
+	}
+	return chain
+}
+
+func forwardedNodeIP(node string) string {
+	return NormalizeIP(strings.Trim(strings.TrimSpace(node), `"`))
+}
+
+// NormalizeIP validates & canonicalizes IP address, stripping port, brackets
+// and zone id, IPv4-mapped IPv6 addresses are converted to IPv4.
+// Returns empty string if ip is not a valid IP address.
+func NormalizeIP(ip string) string {
+	ip = strings.TrimSpace(ip)
+
+	// Bracketed IPv6 with optional port, e.g. [2001:db8:cafe::17]:4711
+	if strings.HasPrefix(ip, "[") {
+		if i := strings.Index(ip, "]"); i > 0 {
+			ip = ip[1:i]
+		}
+	} else if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if i := strings.Index(ip, "%"); i >= 0 {
+		ip = ip[:i]
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return ""
+	}
+	if ipv4 := parsedIP.To4(); ipv4 != nil {
+		return ipv4.String()
+	}
+	return parsedIP.String()
+}
+
+// IPMask aggregates IP addresses into networks of the given prefix length,
+// e.g. IPv6 clients can rotate addresses within a /64. Zero value retains the address.
+type IPMask struct {
+	IPv4, IPv6 int
+}
 
-			partIndex := len(parts) - 1 - forwardedForIndexFromBehind
-			if partIndex < 0 {
-				partIndex = 0
+// Apply masks normalized IP address into network, e.g. "2001:db8::/64"
+func (m IPMask) Apply(ip string) string {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return ip
+	}
+
+	bits, ones := 8*net.IPv6len, m.IPv6
+	if ipv4 := parsedIP.To4(); ipv4 != nil {
+		parsedIP, bits, ones = ipv4, 8*net.IPv4len, m.IPv4
+	}
+	if ones <= 0 || ones >= bits {
+		return ip
+	}
+
+	network := net.IPNet{IP: parsedIP.Mask(net.CIDRMask(ones, bits)), Mask: net.CIDRMask(ones, bits)}
+	return network.String()
+}
+
+// forwardedForIP returns the client address of the chain, empty nodes of the chain
+// are invalid addresses. Chain is not walked past an invalid hop, since the addresses
+// to the left of it can't be trusted, malformed is set instead.
+func forwardedForIP(chain []string, trustedProxies []*net.IPNet, forwardedForIndexFromBehind int) (string, bool) {
+	if len(chain) == 0 {
+		return "", false
+	}
+
+	if len(trustedProxies) == 0 {
+		partIndex := len(chain) - 1 - forwardedForIndexFromBehind
+		if partIndex < 0 {
+			partIndex = 0
+		}
+
+		for i := len(chain) - 1; i >= partIndex; i-- {
+			if chain[i] == "" {
+				return "", true
 			}
+		}
+		return chain[partIndex], false
+	}
 
-			return parts[partIndex]
+	// Client is the right-most address which is not a trusted proxy
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] == "" {
+			return "", true
 		}
-		if lookup == "X-Real-IP" && realIP != "" {
-			return realIP
+		if !IsTrustedProxy(chain[i], trustedProxies) {
+			return chain[i], false
+		}
+	}
+	// Every hop is trusted, left-most address is the client
+	return chain[0], false
+}
+
+// IsTrustedProxy validates if ip belongs to any of the trusted networks
+func IsTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(parsedIP) {
+			return true
 		}
 	}
+	return false
+}
+
+// ParseCIDRs parses list of CIDRs, plain IP addresses are parsed as single host networks
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+var patternEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
 
-	return ""
+// EscapePattern escapes glob characters of redis key patterns, e.g. for SCAN
+func EscapePattern(s string) string {
+	return patternEscaper.Replace(s)
 }
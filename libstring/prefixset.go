@@ -0,0 +1,101 @@
+package libstring
+
+import (
+	"net"
+)
+
+// PrefixSet is a set of networks backed by binary trie, lookups are bound by
+// the length of the address irrespective of the number of networks in set.
+// IPv4 networks are stored as IPv4-mapped IPv6 networks.
+type PrefixSet struct {
+	root *prefixNode
+	size int
+}
+
+type prefixNode struct {
+	children [2]*prefixNode
+	// Network terminates on the node
+	terminal bool
+}
+
+// NewPrefixSet creates set of the given networks
+func NewPrefixSet(networks ...*net.IPNet) *PrefixSet {
+	s := &PrefixSet{root: &prefixNode{}}
+	for _, network := range networks {
+		s.Add(network)
+	}
+	return s
+}
+
+// Add network to the set
+func (s *PrefixSet) Add(network *net.IPNet) {
+	ip := network.IP.To16()
+	if ip == nil {
+		return
+	}
+	ones, bits := network.Mask.Size()
+	if bits == 8*net.IPv4len {
+		ones += 8 * (net.IPv6len - net.IPv4len)
+	}
+
+	node := s.root
+	for i := 0; i < ones; i++ {
+		if node.terminal {
+			// Network is covered by an existing broader network
+			return
+		}
+		bit := ipBit(ip, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &prefixNode{}
+		}
+		node = node.children[bit]
+	}
+	if !node.terminal {
+		node.terminal = true
+		s.size++
+	}
+}
+
+// Contains validates if ip belongs to any of the networks in set
+func (s *PrefixSet) Contains(ip net.IP) bool {
+	if s == nil {
+		return false
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+
+	node := s.root
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == 8*net.IPv6len {
+			break
+		}
+		node = node.children[ipBit(ip, i)]
+	}
+	return false
+}
+
+// ContainsIP validates if ip address belongs to any of the networks in set
+func (s *PrefixSet) ContainsIP(ip string) bool {
+	parsedIP := net.ParseIP(NormalizeIP(ip))
+	if parsedIP == nil {
+		return false
+	}
+	return s.Contains(parsedIP)
+}
+
+// Len returns number of networks added to set, which weren't covered by existing networks
+func (s *PrefixSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return s.size
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,120 @@
+package libstring_test
+
+import (
+	"testing"
+
+	"github.com/alter123/go-ratelimit/libstring"
+)
+
+func newPrefixSet(t *testing.T, cidrs ...string) *libstring.PrefixSet {
+	t.Helper()
+	networks, err := libstring.ParseCIDRs(cidrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return libstring.NewPrefixSet(networks...)
+}
+
+func TestPrefixSetContains(t *testing.T) {
+	s := newPrefixSet(t, "10.0.0.0/8", "192.0.2.1", "198.51.100.128/25", "2001:db8::/32", "2001:db8:ffff::1")
+
+	for _, tc := range []struct {
+		ip       string
+		contains bool
+	}{
+		// IPv4 network boundaries
+		{"10.0.0.0", true},
+		{"10.255.255.255", true},
+		{"9.255.255.255", false},
+		{"11.0.0.0", false},
+		{"198.51.100.128", true},
+		{"198.51.100.255", true},
+		{"198.51.100.127", false},
+		// IPv4 hosts
+		{"192.0.2.1", true},
+		{"192.0.2.0", false},
+		{"192.0.2.2", false},
+		// IPv4-mapped IPv6 addresses match IPv4 networks
+		{"::ffff:10.1.2.3", true},
+		{"::ffff:11.1.2.3", false},
+		// IPv6 network boundaries
+		{"2001:db8::", true},
+		{"2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", true},
+		{"2001:db7:ffff:ffff:ffff:ffff:ffff:ffff", false},
+		{"2001:db9::", false},
+		// IPv6 addresses don't match IPv4 networks of the same bits
+		{"a00::1", false},
+		// Invalid addresses
+		{"", false},
+		{"not-an-ip", false},
+	} {
+		if contains := s.ContainsIP(tc.ip); contains != tc.contains {
+			t.Fatalf("Contains of %q is %v, expected %v", tc.ip, contains, tc.contains)
+		}
+	}
+}
+
+func TestPrefixSetOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cidrs    []string
+		size     int
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "narrower after broader",
+			cidrs:    []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.3"},
+			size:     1,
+			contains: []string{"10.1.2.3", "10.2.0.0"},
+			excludes: []string{"11.1.2.3"},
+		},
+		{
+			name:     "broader after narrower",
+			cidrs:    []string{"10.1.0.0/16", "10.0.0.0/8"},
+			size:     2,
+			contains: []string{"10.1.2.3", "10.2.0.0"},
+		},
+		{
+			name:     "duplicates",
+			cidrs:    []string{"2001:db8::/48", "2001:db8::/48", "2001:db8::1"},
+			size:     1,
+			contains: []string{"2001:db8::1", "2001:db8:0:ffff::1"},
+			excludes: []string{"2001:db8:1::1"},
+		},
+		{
+			name:     "adjacent",
+			cidrs:    []string{"192.0.2.0/25", "192.0.2.128/25"},
+			size:     2,
+			contains: []string{"192.0.2.0", "192.0.2.127", "192.0.2.128", "192.0.2.255"},
+			excludes: []string{"192.0.1.255", "192.0.3.0"},
+		},
+		{
+			name:     "all IPv4 addresses",
+			cidrs:    []string{"0.0.0.0/0"},
+			size:     1,
+			contains: []string{"0.0.0.0", "255.255.255.255"},
+			excludes: []string{"2001:db8::1"},
+		},
+	} {
+		s := newPrefixSet(t, tc.cidrs...)
+		if s.Len() != tc.size {
+			t.Fatalf("%s: Len is %d, expected %d", tc.name, s.Len(), tc.size)
+		}
+		for _, ip := range tc.contains {
+			if !s.ContainsIP(ip) {
+				t.Fatalf("%s: %s is not contained", tc.name, ip)
+			}
+		}
+		for _, ip := range tc.excludes {
+			if s.ContainsIP(ip) {
+				t.Fatalf("%s: %s is contained", tc.name, ip)
+			}
+		}
+	}
+
+	var empty *libstring.PrefixSet
+	if empty.ContainsIP("10.0.0.1") || empty.Len() != 0 {
+		t.Fatal("Nil set contains addresses.")
+	}
+}
@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/alter123/go-ratelimit/libstring"
+)
+
+// Allow & deny lists are consulted before the store, allowed requests bypass
+// the limiter while denied requests are rejected outright. Deny list takes
+// precedence if request is present in both lists.
+type accessList struct {
+	ips     *libstring.PrefixSet
+	userIds map[string]bool
+}
+
+func newAccessList(networks []*net.IPNet, userIds []string) *accessList {
+	al := &accessList{
+		ips:     libstring.NewPrefixSet(networks...),
+		userIds: make(map[string]bool, len(userIds)),
+	}
+	for _, userId := range userIds {
+		al.userIds[userId] = true
+	}
+	return al
+}
+
+func (al *accessList) contains(ip, userId string) bool {
+	if al == nil {
+		return false
+	}
+	if ip != "" && al.ips.ContainsIP(ip) {
+		return true
+	}
+	return userId != "" && al.userIds[userId]
+}
+
+// SetAllowList for setting networks & user ids which bypass the limiter,
+// e.g. internal monitoring. See libstring.ParseCIDRs to parse the networks.
+func (l *Limiter) SetAllowList(networks []*net.IPNet, userIds ...string) *Limiter {
+	l.allowList = newAccessList(networks, userIds)
+	return l
+}
+
+// SetDenyList for setting networks & user ids which are rejected outright
+func (l *Limiter) SetDenyList(networks []*net.IPNet, userIds ...string) *Limiter {
+	l.denyList = newAccessList(networks, userIds)
+	return l
+}
+
+// IsAllowed validates if request is present in allow list
+func (l *Limiter) IsAllowed(r *http.Request) bool {
+	if l.allowList == nil {
+		return false
+	}
+	return l.allowList.contains(l.RemoteIP(r), l.accessListUserId(r))
+}
+
+// IsDenied validates if request is present in deny list
+func (l *Limiter) IsDenied(r *http.Request) bool {
+	if l.denyList == nil {
+		return false
+	}
+	return l.denyList.contains(l.RemoteIP(r), l.accessListUserId(r))
+}
+
+func (l *Limiter) accessListUserId(r *http.Request) string {
+	if !l.GetIncludeUserId() {
+		return ""
+	}
+	userId, _ := l.GetUserId(r)
+	return userId
+}
@@ -0,0 +1,114 @@
+package limiter
+
+import (
+	"time"
+
+	limiterlib "github.com/ulule/limiter/v3"
+)
+
+// Tiers deciding the outcome of the request
+const (
+	TierDeny                = "deny"
+	TierIdentity            = "identity"
+	TierPluggable           = "pluggable"
+	TierGlobal              = "global"
+	TierUserGlobal          = "user_global"
+	TierAuthenticatedGlobal = "authenticated_global"
+	TierPlan                = "plan"
+	TierMethod              = "method"
+	TierOverride            = "override"
+	TierRequest             = "request"
+)
+
+// TierContext is the limit context of a single tier evaluated for the request
+type TierContext struct {
+	Tier string `json:"tier"`
+	// Suffix of the pluggable limiter, plan or method, identity of the override
+	Suffix string `json:"suffix,omitempty"`
+	// Key passed to the store, which is prefixed by LimiterOptions.Prefix
+	Key string `json:"key,omitempty"`
+
+	Limit     int64 `json:"limit"`
+	Remaining int64 `json:"remaining"`
+	Reset     int64 `json:"reset"`
+	Reached   bool  `json:"reached"`
+	// Limit is reached in shadow mode, the request is not rejected by the tier
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+func newContext(lctx limiterlib.Context, tier, suffix, key string) Context {
+	c := Context{
+		Limit:     lctx.Limit,
+		Remaining: lctx.Remaining,
+		Reset:     lctx.Reset,
+		Reached:   lctx.Reached,
+		Tier:      tier,
+		Suffix:    suffix,
+		Key:       key,
+	}
+	c.Tiers = []TierContext{c.TierContext()}
+	return c.withTiming(time.Now())
+}
+
+// withTiming derives reset time & retry after from reset timestamp
+func (c Context) withTiming(now time.Time) Context {
+	c.ResetAt, c.RetryAfter = time.Time{}, 0
+	if c.Reset > 0 {
+		c.ResetAt = time.Unix(c.Reset, 0)
+	}
+	if c.Reached && c.ResetAt.After(now) {
+		c.RetryAfter = c.ResetAt.Sub(now)
+	}
+	return c
+}
+
+// TierContext returns limit context of the deciding tier
+func (c *Context) TierContext() TierContext {
+	return TierContext{
+		Tier:      c.Tier,
+		Suffix:    c.Suffix,
+		Key:       c.Key,
+		Limit:     c.Limit,
+		Remaining: c.Remaining,
+		Reset:     c.Reset,
+		Reached:   c.Reached,
+		Shadow:    c.Shadow,
+	}
+}
+
+// Shadowed returns the context allowing request rejected in shadow mode,
+// reached tiers are reported as shadow
+func (c Context) Shadowed() Context {
+	if !c.Reached {
+		return c
+	}
+	c.Reached, c.Shadow, c.RetryAfter = false, true, 0
+
+	tiers := make([]TierContext, len(c.Tiers))
+	copy(tiers, c.Tiers)
+	for i := range tiers {
+		if tiers[i].Reached {
+			tiers[i].Shadow = true
+		}
+	}
+	c.Tiers = tiers
+	return c
+}
+
+// ShadowTier returns the first tier which would have rejected the request in shadow mode
+func (c *Context) ShadowTier() (TierContext, bool) {
+	for _, t := range c.Tiers {
+		if t.Shadow {
+			return t, true
+		}
+	}
+	return TierContext{}, false
+}
+
+// DeniedContext is the limit context of the request rejected by policy of the tier,
+// either TierDeny or TierIdentity
+func DeniedContext(tier string) Context {
+	c := Context{Reached: true, Denied: true, Tier: tier}
+	c.Tiers = []TierContext{c.TierContext()}
+	return c
+}
@@ -0,0 +1,75 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	// ErrStoreUnavailable is matched by errors returned by the store, see StoreError
+	ErrStoreUnavailable = errors.New("limiter: store unavailable")
+	// ErrNotInitialised is returned when limiter is used before Init, see SetStrictInit
+	ErrNotInitialised = errors.New("limiter: not initialised")
+	// ErrInvalidConfig is matched by validation errors of limiters & policies
+	ErrInvalidConfig = errors.New("limiter: invalid config")
+	// ErrLimitExceeded is matched by LimitExceededError, see Context.Err
+	ErrLimitExceeded = errors.New("limiter: limit exceeded")
+)
+
+// StoreError wraps error returned by the store for the key of tier
+type StoreError struct {
+	Tier, Key string
+	Err       error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("limiter: store unavailable for %s tier key %q: %v", e.Tier, e.Key, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StoreError) Is(target error) bool {
+	return target == ErrStoreUnavailable
+}
+
+// Timeout validates if store call failed due to timeout or cancelled deadline
+func (e *StoreError) Timeout() bool {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+func storeError(tier, key string, err error) error {
+	return &StoreError{Tier: tier, Key: key, Err: err}
+}
+
+// LimitExceededError carries the decision of the rejected request
+type LimitExceededError struct {
+	Context Context
+}
+
+func (e *LimitExceededError) Error() string {
+	c := e.Context
+	if c.Denied {
+		return fmt.Sprintf("limiter: request denied by %s tier", c.Tier)
+	}
+	return fmt.Sprintf("limiter: limit exceeded by %s tier, retry after %s", c.Tier, c.RetryAfter)
+}
+
+func (e *LimitExceededError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Err returns *LimitExceededError if limit is reached, nil otherwise
+func (c Context) Err() error {
+	if !c.Reached {
+		return nil
+	}
+	return &LimitExceededError{Context: c}
+}
@@ -0,0 +1,24 @@
+package limiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+func TestTypedErrors(t *testing.T) {
+	var storeErr *limiter.StoreError
+	err := error(&limiter.StoreError{Tier: limiter.TierGlobal, Err: context.DeadlineExceeded})
+	if !errors.Is(err, limiter.ErrStoreUnavailable) || !errors.As(err, &storeErr) || !storeErr.Timeout() {
+		t.Fatalf("Store error is invalid: %v", err)
+	}
+
+	_, err = limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 1}).
+		SetLimits(0).Build()
+	if !errors.Is(err, limiter.ErrInvalidConfig) {
+		t.Fatalf("Config error is invalid: %v", err)
+	}
+}
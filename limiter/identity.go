@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// IdentitySource resolves identity of the user making the request,
+// empty identity denotes that source is not present in the request.
+type IdentitySource func(l *Limiter, r *http.Request) (string, error)
+
+// IdentityContext resolves identity via FuncFetchFromContext set on the limiter
+func IdentityContext(l *Limiter, r *http.Request) (string, error) {
+	return l.GetUserIdFromContext(r)
+}
+
+// IdentityHeader resolves identity from the given header, e.g. X-API-Key
+func IdentityHeader(name string) IdentitySource {
+	return func(l *Limiter, r *http.Request) (string, error) {
+		return KeyHeader(name)(l, r)
+	}
+}
+
+// IdentityCookie resolves identity from the given cookie, e.g. session id
+func IdentityCookie(name string) IdentitySource {
+	return func(l *Limiter, r *http.Request) (string, error) {
+		return KeyCookie(name)(l, r)
+	}
+}
+
+// HashIdentity wraps identity source to hash the identity with sha256,
+// so that secrets such as api keys are not stored in plain text as keys
+func HashIdentity(source IdentitySource) IdentitySource {
+	return func(l *Limiter, r *http.Request) (string, error) {
+		identity, err := source(l, r)
+		if err != nil || identity == "" {
+			return identity, err
+		}
+		sum := sha256.Sum256([]byte(identity))
+		return hex.EncodeToString(sum[:]), nil
+	}
+}
+
+// SetIdentitySources for setting sources to resolve user id from. Sources are
+// consulted in the given order & the first non-empty identity takes precedence,
+// add IdentityContext to the sources to consider FuncFetchFromContext as well.
+func (l *Limiter) SetIdentitySources(sources ...IdentitySource) *Limiter {
+	l.identitySources = sources
+	if len(sources) > 0 {
+		l.SetIncludeUserId(true)
+	}
+	return l
+}
+
+func (l *Limiter) GetIdentitySources() []IdentitySource {
+	return l.identitySources
+}
+
+// GetUserId resolves user id of the request from identity sources,
+// defaults to FuncFetchFromContext if no identity sources are set
+func (l *Limiter) GetUserId(r *http.Request) (string, error) {
+	if len(l.identitySources) == 0 {
+		return l.GetUserIdFromContext(r)
+	}
+
+	var firstErr error
+	for _, source := range l.identitySources {
+		identity, err := source(l, r)
+		if err != nil {
+			// Fallback to next source, error is returned if none resolves
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if identity != "" {
+			return identity, nil
+		}
+	}
+	return "", firstErr
+}
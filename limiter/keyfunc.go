@@ -0,0 +1,110 @@
+package limiter
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// KeyFunc extracts a single dimension of the rate limit key from request.
+// Returned errors are treated as an empty dimension by the key builder.
+type KeyFunc func(l *Limiter, r *http.Request) (string, error)
+
+// KeyIP extracts remote ip address based upon the ip lookups of limiter,
+// aggregated into network as per SetIPMask
+func KeyIP(l *Limiter, r *http.Request) (string, error) {
+	return l.GetIPMask().Apply(l.KeyRemoteIP(r)), nil
+}
+
+// KeyPath extracts url path of the request
+func KeyPath(_ *Limiter, r *http.Request) (string, error) {
+	return r.URL.Path, nil
+}
+
+// KeyMethod extracts request method, honouring the methods set via SetMethods
+func KeyMethod(l *Limiter, r *http.Request) (string, error) {
+	return l.GetMethods(r), nil
+}
+
+// KeyHost extracts host of the request
+func KeyHost(_ *Limiter, r *http.Request) (string, error) {
+	return r.Host, nil
+}
+
+// KeyUserId extracts user id from the identity sources, if enabled on limiter
+func KeyUserId(l *Limiter, r *http.Request) (string, error) {
+	if !l.GetIncludeUserId() {
+		return "", nil
+	}
+	return l.GetUserId(r)
+}
+
+// KeyHeader extracts value of the given header
+func KeyHeader(name string) KeyFunc {
+	return func(_ *Limiter, r *http.Request) (string, error) {
+		return r.Header.Get(name), nil
+	}
+}
+
+// KeyCookie extracts value of the given cookie, missing cookie yields empty value
+func KeyCookie(name string) KeyFunc {
+	return func(_ *Limiter, r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err == http.ErrNoCookie {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return cookie.Value, nil
+	}
+}
+
+// KeyQuery extracts value of the given query param
+func KeyQuery(name string) KeyFunc {
+	return func(_ *Limiter, r *http.Request) (string, error) {
+		return r.URL.Query().Get(name), nil
+	}
+}
+
+// KeyContextValue extracts value stored in request context against key
+func KeyContextValue(key interface{}) KeyFunc {
+	return func(_ *Limiter, r *http.Request) (string, error) {
+		switch v := r.Context().Value(key).(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		case fmt.Stringer:
+			return v.String(), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	}
+}
+
+// SetKeyFuncs for composing the request key from given extractors,
+// overrides the default ip|path|method|userId|additionalContext key
+func (l *Limiter) SetKeyFuncs(keyFuncs ...KeyFunc) *Limiter {
+	l.keyFuncs = keyFuncs
+	l.keyTemplate = ""
+	return l
+}
+
+func (l *Limiter) GetKeyFuncs() []KeyFunc {
+	return l.keyFuncs
+}
+
+// HasKeyFuncs to determine if request key is composed by key extractors
+func (l *Limiter) HasKeyFuncs() bool {
+	return len(l.keyFuncs) > 0
+}
+
+// BuildRequestKey runs the key extractors in order and returns the dimensions
+func (l *Limiter) BuildRequestKey(r *http.Request) LimiterKeysValue {
+	sliceKey := make(LimiterKeysValue, len(l.keyFuncs))
+	for i, f := range l.keyFuncs {
+		// Extractors are best effort, similar to additional context
+		sliceKey[i], _ = f(l, r)
+	}
+	return sliceKey
+}
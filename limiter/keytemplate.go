@@ -0,0 +1,90 @@
+package limiter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Separator between the name & argument of a key template dimension
+const keyTemplateArgSeparator = ":"
+
+// Dimensions supported by key templates which don't accept argument
+var keyTemplateFuncs = map[string]KeyFunc{
+	"ip":     KeyIP,
+	"path":   KeyPath,
+	"route":  KeyPath,
+	"method": KeyMethod,
+	"host":   KeyHost,
+	"user":   KeyUserId,
+}
+
+// Dimensions supported by key templates which require argument, e.g. header:X-API-Key
+var keyTemplateArgFuncs = map[string]func(string) KeyFunc{
+	"header": KeyHeader,
+	"cookie": KeyCookie,
+	"query":  KeyQuery,
+}
+
+// ParseKeyTemplate parses key template such as "ip|route|header:X-API-Key|query:tenant"
+// into key extractors, dimensions are separated by KeyJoinIdentifier.
+func ParseKeyTemplate(tmpl string) ([]KeyFunc, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		return nil, fmt.Errorf("%w: key template is empty", ErrInvalidConfig)
+	}
+
+	dimensions := strings.Split(tmpl, KeyJoinIdentifier)
+	keyFuncs := make([]KeyFunc, 0, len(dimensions))
+	for i, dimension := range dimensions {
+		keyFunc, err := parseKeyTemplateDimension(strings.TrimSpace(dimension))
+		if err != nil {
+			return nil, fmt.Errorf("%w: key template %q at dimension %d: %v", ErrInvalidConfig, tmpl, i+1, err)
+		}
+		keyFuncs = append(keyFuncs, keyFunc)
+	}
+	return keyFuncs, nil
+}
+
+func parseKeyTemplateDimension(dimension string) (KeyFunc, error) {
+	if dimension == "" {
+		return nil, fmt.Errorf("dimension is empty")
+	}
+
+	name, arg := dimension, ""
+	hasArg := false
+	if i := strings.Index(dimension, keyTemplateArgSeparator); i >= 0 {
+		name, arg, hasArg = dimension[:i], strings.TrimSpace(dimension[i+1:]), true
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if f, exists := keyTemplateFuncs[name]; exists {
+		if hasArg {
+			return nil, fmt.Errorf("dimension %q does not accept an argument", name)
+		}
+		return f, nil
+	}
+
+	if f, exists := keyTemplateArgFuncs[name]; exists {
+		if arg == "" {
+			return nil, fmt.Errorf("dimension %q requires an argument, e.g. %s:name", name, name)
+		}
+		return f(arg), nil
+	}
+
+	return nil, fmt.Errorf("unknown dimension %q", name)
+}
+
+// SetKeyTemplate for composing request key from key template, see ParseKeyTemplate
+func (l *Limiter) SetKeyTemplate(tmpl string) (*Limiter, error) {
+	keyFuncs, err := ParseKeyTemplate(tmpl)
+	if err != nil {
+		return l, err
+	}
+	l.SetKeyFuncs(keyFuncs...)
+	l.keyTemplate = tmpl
+	return l, nil
+}
+
+// GetKeyTemplate returns key template the request key is composed from, if any
+func (l *Limiter) GetKeyTemplate() string {
+	return l.keyTemplate
+}
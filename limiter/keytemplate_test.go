@@ -0,0 +1,34 @@
+package limiter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+func TestSetKeyTemplate(t *testing.T) {
+	tmpl := "ip|route|header:X-API-Key"
+	lmt, err := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 2}).
+		SetKeyTemplate(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lmt.GetKeyTemplate() != tmpl || len(lmt.GetKeyFuncs()) != 3 {
+		t.Fatalf("Key template is not set: %q, %d key funcs", lmt.GetKeyTemplate(), len(lmt.GetKeyFuncs()))
+	}
+
+	// Key funcs set directly replace the template
+	if lmt.SetKeyFuncs(limiter.KeyIP).GetKeyTemplate() != "" {
+		t.Fatalf("Key template is retained: %q", lmt.GetKeyTemplate())
+	}
+}
+
+func TestParseKeyTemplate(t *testing.T) {
+	for _, tmpl := range []string{"", "ip||path", "ip|header", "ip:1", "ip|unknown"} {
+		if _, err := limiter.ParseKeyTemplate(tmpl); err == nil {
+			t.Fatalf("Key template %q should be invalid.", tmpl)
+		}
+	}
+}
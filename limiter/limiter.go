@@ -2,10 +2,12 @@ package limiter
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/alter123/go-ratelimit/libstring"
 	libredis "github.com/redis/go-redis/v9"
 	limiterlib "github.com/ulule/limiter/v3"
 	sredis "github.com/ulule/limiter/v3/drivers/store/redis"
@@ -16,6 +18,9 @@ const RateLimitErrorMessage = "You have reached maximum request limit."
 var (
 	// Global limiter store
 	redisStore limiterlib.Store
+	// Client & key prefix of the store, for inspecting & managing counters
+	redisClient *libredis.Client
+	storePrefix string
 	// Global func to fetch from request context
 	FetchFromContext FuncFetchFromContext
 	// Additional context per request
@@ -29,7 +34,47 @@ type Limiter struct {
 	// List of places to look up IP address
 	// Default is "CF-Connecting-IP", "RemoteAddr", "X-Forwarded-For", "X-Real-IP"
 	// You can rearrange the order as you like
-	ipLookups []string
+	ipLookups []libstring.IPLookup
+
+	// Forwarded headers are honoured only if RemoteAddr is a trusted proxy
+	trustedProxies []*net.IPNet
+	// Index of client address in forwarded headers from the right-most hop,
+	// defaults to the right-most hop which is appended by the nearest proxy
+	forwardedForIndexFromBehind int
+
+	// Aggregate IP addresses into networks on request & global keys
+	ipMask, globalIPMask libstring.IPMask
+
+	// Requests which bypass the limiter & which are rejected outright
+	allowList, denyList *accessList
+
+	// Rules to bypass the limiter, e.g. health checks
+	skippers []Skipper
+
+	// Outcome of requests without ip & user id
+	missingIdentityPolicy MissingIdentityPolicy
+	missingIdentityKey    string
+
+	// Request limits per plan, resolved at request time
+	planResolver FuncResolvePlan
+	plans        pluggableSet
+
+	// Request limits per HTTP method, e.g. stricter limits for writes
+	methodLimits pluggableSet
+
+	// Global limits of authenticated requests, per user & per ip
+	userGlobal, authenticatedGlobal *Pluggable
+
+	// Apply pluggable limits to authenticated requests per user
+	pluggableForAuthenticated bool
+
+	// Overrides of the request limits per identity
+	overrides OverrideStore
+
+	// Observers notified of the outcome of requests
+	observers []Observer
+	// Hooks invoked after every call to the store
+	storeHooks []StoreHook
 
 	// List of HTTP Methods to limit (GET, POST, PUT, etc.)
 	// Empty means limit all methods
@@ -45,8 +90,20 @@ type Limiter struct {
 	// HTTP message when limit is reached.
 	message string
 
+	// Name of the policy, reported on the limit context
+	name string
+
+	// Evaluate limits without enforcing them
+	shadow bool
+
+	// Return ErrNotInitialised if used before Init, instead of failing open
+	strictInit bool
+
 	userIdFromContext FuncFetchFromContext
 
+	// Sources to resolve user id from, in the order of precedence
+	identitySources []IdentitySource
+
 	// Path specific additional context per request
 	additionalContextFunc FuncFetchParamFromContext
 
@@ -55,6 +112,11 @@ type Limiter struct {
 	// Ignore URL on the rate limiter keys
 	ignoreURL bool
 
+	// Key extractors to compose request key, overrides default key dimensions
+	keyFuncs []KeyFunc
+	// Key template the key extractors are parsed from
+	keyTemplate string
+
 	limiter, globalLimiter *limiterlib.Limiter
 	// Pluggable limiters allows support to override supported limits by `limiter`
 	pluggableLimiter *PluggableLimiter
@@ -63,8 +125,10 @@ type Limiter struct {
 func Init(config LimiterOptions) {
 	FetchFromContext = config.FuncFetchFromContext
 	AdditionalContext = config.FuncAdditionalContext
+	SetLogger(config.Logger)
 
 	client := libredis.NewClient(config.Redis)
+	redisClient, storePrefix = client, config.Prefix
 
 	storeOptions := limiterlib.StoreOptions{
 		MaxRetry: 3,
@@ -79,6 +143,16 @@ func Init(config LimiterOptions) {
 	}
 }
 
+// GetStoreClient returns redis client of the store, nil if not initialised
+func GetStoreClient() *libredis.Client {
+	return redisClient
+}
+
+// GetStorePrefix returns prefix of the store keys, keys are formatted as prefix:key
+func GetStorePrefix() string {
+	return storePrefix
+}
+
 func New(generalExpirableOptions *ExpirableOptions) *Limiter {
 	lmt := &Limiter{}
 
@@ -103,7 +177,7 @@ func New(generalExpirableOptions *ExpirableOptions) *Limiter {
 		lmt.SetGlobalTtl(1 * time.Minute)
 	}
 	if lmt.GetGlobalLimits() == 0 {
-		lmt.SetGlobalLimits(12)
+		lmt.SetGlobalLimits(60)
 	}
 
 	lmt.SetIPLookups([]string{"CF-Connecting-IP", "X-Forwarded-For", "RemoteAddr", "X-Real-IP"})
@@ -116,28 +190,28 @@ func New(generalExpirableOptions *ExpirableOptions) *Limiter {
 
 	lmt.SetErrorMessage(RateLimitErrorMessage)
 
-	lmt.limiter = &limiterlib.Limiter{
-		Store: redisStore,
-		Rate: limiterlib.Rate{
-			Period: lmt.GetTtl(),
-			Limit:  lmt.GetLimits(),
-		},
-	}
+	lmt.limiter = newStoreLimiter(lmt.expiry)
+	lmt.globalLimiter = newStoreLimiter(lmt.globalExpiry)
 
-	lmt.globalLimiter = &limiterlib.Limiter{
+	return lmt
+}
+
+func newStoreLimiter(eo ExpirableOptions) *limiterlib.Limiter {
+	return &limiterlib.Limiter{
 		Store: redisStore,
 		Rate: limiterlib.Rate{
-			Period: lmt.GetGlobalTtl(),
-			Limit:  lmt.GetGlobalLimits(),
+			Period: eo.DefaultExpirationTTL,
+			Limit:  eo.ExpireJobInterval,
 		},
 	}
-
-	return lmt
 }
 
-// SetIPLookups for setting limit of allowed requests for ttl
+// SetLimits for setting limit of allowed requests for ttl
 func (l *Limiter) SetLimits(limit int64) *Limiter {
 	l.expiry.ExpireJobInterval = limit
+	if l.limiter != nil {
+		l.limiter = newStoreLimiter(l.expiry)
+	}
 	return l
 }
 
@@ -148,6 +222,9 @@ func (l *Limiter) GetLimits() int64 {
 // SetIPLookups for setting list of places to look up IP address
 func (l *Limiter) SetTtl(ttl time.Duration) *Limiter {
 	l.expiry.DefaultExpirationTTL = ttl
+	if l.limiter != nil {
+		l.limiter = newStoreLimiter(l.expiry)
+	}
 	return l
 }
 
@@ -157,6 +234,9 @@ func (l *Limiter) GetTtl() time.Duration {
 
 func (l *Limiter) SetGlobalLimits(limit int64) *Limiter {
 	l.globalExpiry.ExpireJobInterval = limit
+	if l.globalLimiter != nil {
+		l.globalLimiter = newStoreLimiter(l.globalExpiry)
+	}
 	return l
 }
 
@@ -167,6 +247,9 @@ func (l *Limiter) GetGlobalLimits() int64 {
 // SetIPLookups for setting list of places to look up IP address
 func (l *Limiter) SetGlobalTtl(ttl time.Duration) *Limiter {
 	l.globalExpiry.DefaultExpirationTTL = ttl
+	if l.globalLimiter != nil {
+		l.globalLimiter = newStoreLimiter(l.globalExpiry)
+	}
 	return l
 }
 
@@ -176,16 +259,97 @@ func (l *Limiter) GetGlobalTtl() time.Duration {
 
 // SetIPLookups for setting list of places to look up IP address
 func (l *Limiter) SetIPLookups(ipLookups []string) *Limiter {
-	l.ipLookups = ipLookups
+	l.ipLookups = libstring.IPLookups(ipLookups...)
 	return l
 }
 
 func (l *Limiter) GetIPLookups() []string {
+	ipLookups := make([]string, len(l.ipLookups))
+	for i, lookup := range l.ipLookups {
+		ipLookups[i] = lookup.Name
+	}
+	return ipLookups
+}
+
+// SetIPLookupRules for setting list of places to look up IP address,
+// each with its own trusted proxies e.g. "True-Client-IP" or "Forwarded"
+func (l *Limiter) SetIPLookupRules(ipLookups ...libstring.IPLookup) *Limiter {
+	l.ipLookups = ipLookups
+	return l
+}
+
+func (l *Limiter) GetIPLookupRules() []libstring.IPLookup {
 	return l.ipLookups
 }
 
+// SetTrustedProxies for setting networks of the proxies trusted to forward client IP,
+// see libstring.ParseCIDRs to parse the networks
+func (l *Limiter) SetTrustedProxies(trustedProxies []*net.IPNet) *Limiter {
+	l.trustedProxies = trustedProxies
+	return l
+}
+
+func (l *Limiter) GetTrustedProxies() []*net.IPNet {
+	return l.trustedProxies
+}
+
+// SetForwardedForIndexFromBehind for setting index of the client address in
+// forwarded headers counted from the right-most hop, e.g. 1 behind two proxies
+// appending to the header. Unused if trusted proxies are set.
+func (l *Limiter) SetForwardedForIndexFromBehind(index int) *Limiter {
+	l.forwardedForIndexFromBehind = index
+	return l
+}
+
+func (l *Limiter) GetForwardedForIndexFromBehind() int {
+	return l.forwardedForIndexFromBehind
+}
+
+// SetIPMask for aggregating IP addresses into networks on request keys,
+// e.g. SetIPMask(32, 64) limits IPv6 clients by /64 networks
+func (l *Limiter) SetIPMask(ipv4Bits, ipv6Bits int) *Limiter {
+	l.ipMask = libstring.IPMask{IPv4: ipv4Bits, IPv6: ipv6Bits}
+	return l
+}
+
+func (l *Limiter) GetIPMask() libstring.IPMask {
+	return l.ipMask
+}
+
+// SetGlobalIPMask for aggregating IP addresses into networks on global keys
+func (l *Limiter) SetGlobalIPMask(ipv4Bits, ipv6Bits int) *Limiter {
+	l.globalIPMask = libstring.IPMask{IPv4: ipv4Bits, IPv6: ipv6Bits}
+	return l
+}
+
+func (l *Limiter) GetGlobalIPMask() libstring.IPMask {
+	return l.globalIPMask
+}
+
+// RemoteIP finds normalized IP address of the request based upon ip lookups
+func (l *Limiter) RemoteIP(r *http.Request) string {
+	ip, _ := libstring.RemoteIPWithOptions(l.ipOptions(), r)
+	return ip
+}
+
+// RemoteIPLookup returns remote ip along with the name of the lookup it's found by
+func (l *Limiter) RemoteIPLookup(r *http.Request) (ip, lookup string) {
+	return libstring.RemoteIPWithOptions(l.ipOptions(), r)
+}
+
+func (l *Limiter) ipOptions() libstring.IPOptions {
+	return libstring.IPOptions{
+		Lookups:                     l.GetIPLookupRules(),
+		TrustedProxies:              l.GetTrustedProxies(),
+		ForwardedForIndexFromBehind: l.GetForwardedForIndexFromBehind(),
+	}
+}
+
 // SetMethods for setting list of HTTP Methods to limit (GET, POST, PUT, etc.)
 func (l *Limiter) SetMethods(methods []string) *Limiter {
+	if l.methods == nil {
+		l.methods = make(map[string]bool, len(methods))
+	}
 	for _, method := range methods {
 		l.methods[strings.ToUpper(method)] = true
 	}
@@ -236,6 +400,10 @@ func (l *Limiter) SetAdditionalContextParam(params ...string) *Limiter {
 }
 
 func (l *Limiter) GetAdditionalContextParam(r *http.Request) (string, error) {
+	// Additional context is optional on init
+	if l.additionalContextFunc == nil {
+		return "", nil
+	}
 	return l.additionalContextFunc(r, l.additionalContextParams)
 }
 
@@ -254,6 +422,47 @@ func (l *Limiter) GetIncludeUserId() bool {
 	return l.includeUserId
 }
 
+// SetName for setting name of the policy limiter enforces, e.g. login
+func (l *Limiter) SetName(name string) *Limiter {
+	l.name = name
+	return l
+}
+
+func (l *Limiter) GetName() string {
+	return l.name
+}
+
+// SetShadow for evaluating limits without enforcing them, e.g. to tune new limits
+// on production traffic. Requests which would have been rejected are allowed &
+// reported via Context.Shadow, all the tiers are evaluated & counted.
+func (l *Limiter) SetShadow(shadow bool) *Limiter {
+	l.shadow = shadow
+	return l
+}
+
+func (l *Limiter) GetShadow() bool {
+	return l.shadow
+}
+
+// SetStrictInit for returning ErrNotInitialised from the limits if limiter is
+// used before Init. Requests are allowed otherwise, i.e. the limiter fails open.
+func (l *Limiter) SetStrictInit(strict bool) *Limiter {
+	l.strictInit = strict
+	return l
+}
+
+func (l *Limiter) GetStrictInit() bool {
+	return l.strictInit
+}
+
+// notInitialised allows the request, unless strict init is set
+func (l *Limiter) notInitialised() (Context, error) {
+	if l.strictInit {
+		return Context{}, ErrNotInitialised
+	}
+	return Context{}, nil
+}
+
 func (l *Limiter) SetErrorMessage(message string) *Limiter {
 	l.message = message
 	return l
@@ -274,33 +483,24 @@ func (l *Limiter) GetIgnoreURL() bool {
 	return l.ignoreURL
 }
 
-// Validates if limiter has been successfully initialised to facilitate silent failover otherwise
+// Validates if limiter has been successfully initialised, limits allow the
+// requests otherwise, or return ErrNotInitialised if strict init is set
 func (l *Limiter) IsInitialised() bool {
 	return l.limiter.Store != nil
 }
 
 func (l *Limiter) LimitReached(ctx context.Context, key string) (Context, error) {
 	if !l.IsInitialised() {
-		return Context{}, nil
+		return l.notInitialised()
 	}
 
-	lctx, err := l.limiter.Get(ctx, key)
-	if err != nil {
-		return Context{}, err
-	}
-
-	return Context(lctx), err
+	return l.storeGet(ctx, l.limiter, TierRequest, "", key, l.shadow)
 }
 
 func (l *Limiter) GlobalLimitReached(ctx context.Context, key string) (Context, error) {
 	if !l.IsInitialised() {
-		return Context{}, nil
-	}
-
-	lctx, err := l.globalLimiter.Get(ctx, key)
-	if err != nil {
-		return Context{}, err
+		return l.notInitialised()
 	}
 
-	return Context(lctx), err
+	return l.storeGet(ctx, l.globalLimiter, TierGlobal, "", key, l.shadow)
 }
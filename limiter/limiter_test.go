@@ -0,0 +1,157 @@
+package limiter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/libstring"
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+func TestForwardedForIndex(t *testing.T) {
+	lmt := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 2}).
+		SetIPLookups([]string{"X-Forwarded-For", "RemoteAddr"})
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "10.1.1.1:4321"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.9, 192.0.2.1")
+
+	// Left-most addresses are set by the client, right-most hop is the default
+	if ip := lmt.RemoteIP(r); ip != "192.0.2.1" {
+		t.Fatalf("Remote ip is not right-most address: %q", ip)
+	}
+
+	if ip := lmt.SetForwardedForIndexFromBehind(1).RemoteIP(r); ip != "203.0.113.9" {
+		t.Fatalf("Remote ip is not at index 1 from behind: %q", ip)
+	}
+
+	// Trusted proxies are skipped regardless of the index
+	trustedProxies, err := libstring.ParseCIDRs("10.0.0.0/8", "192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := lmt.SetForwardedForIndexFromBehind(0).SetTrustedProxies(trustedProxies).RemoteIP(r); ip != "203.0.113.9" {
+		t.Fatalf("Remote ip is not right-most untrusted address: %q", ip)
+	}
+}
+
+func TestMalformedForwardedFor(t *testing.T) {
+	trustedProxies, err := libstring.ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "10.1.1.1:4321"
+	r.Header.Set("X-Real-IP", "1.1.1.1")
+
+	lmt := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 2}).
+		SetIPLookups([]string{"X-Forwarded-For", "X-Real-IP", "RemoteAddr"})
+
+	// Addresses left of the invalid hop are set by the client, RemoteAddr is used instead
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, not-an-ip")
+	if ip := lmt.RemoteIP(r); ip != "10.1.1.1" {
+		t.Fatalf("Remote ip of invalid right-most hop is not RemoteAddr: %q", ip)
+	}
+
+	lmt.SetTrustedProxies(trustedProxies)
+	if ip := lmt.RemoteIP(r); ip != "10.1.1.1" {
+		t.Fatalf("Remote ip of invalid right-most hop is not RemoteAddr: %q", ip)
+	}
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.9, garbage, 10.2.2.2")
+	if ip := lmt.RemoteIP(r); ip != "10.1.1.1" {
+		t.Fatalf("Remote ip of invalid untrusted hop is not RemoteAddr: %q", ip)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	trustedProxies, err := libstring.ParseCIDRs("10.0.0.0/8", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lmt := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 2}).
+		SetTrustedProxies(trustedProxies).SetIPLookups([]string{"X-Forwarded-For", "RemoteAddr"})
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Forwarded headers are ignored from untrusted hops
+	r.RemoteAddr = "198.51.100.7:4321"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if ip := lmt.RemoteIP(r); ip != "198.51.100.7" {
+		t.Fatalf("Remote ip is not RemoteAddr: %q", ip)
+	}
+
+	// Right-most untrusted address is the client
+	r.RemoteAddr = "10.1.1.1:4321"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.9, 192.0.2.1, 10.2.2.2")
+	if ip := lmt.RemoteIP(r); ip != "203.0.113.9" {
+		t.Fatalf("Remote ip is not right-most untrusted address: %q", ip)
+	}
+}
+
+func TestForwardedAndCustomIPLookups(t *testing.T) {
+	trustedProxies, err := libstring.ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lmt := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 2}).
+		SetIPLookupRules(
+			libstring.IPLookup{Name: "Fastly-Client-IP", TrustedProxies: trustedProxies},
+			libstring.IPLookup{Name: "Forwarded"},
+		)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.RemoteAddr = "198.51.100.7:4321"
+	r.Header.Set("Fastly-Client-IP", "203.0.113.9")
+	r.Header.Set("Forwarded", `for=_hidden, for="[2001:db8:cafe::17]:4711";proto=https`)
+
+	// Custom header is ignored from untrusted hop, Forwarded is trusted from anyone
+	if ip := lmt.RemoteIP(r); ip != "2001:db8:cafe::17" {
+		t.Fatalf("Remote ip is not Forwarded address: %q", ip)
+	}
+
+	r.RemoteAddr = "10.1.1.1:4321"
+	if ip := lmt.RemoteIP(r); ip != "203.0.113.9" {
+		t.Fatalf("Remote ip is not Fastly-Client-IP: %q", ip)
+	}
+}
+
+func TestNotInitialised(t *testing.T) {
+	lmt := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 2}).
+		SetPluggableLimiter([]limiter.ExpirableOptions{{DefaultExpirationTTL: time.Second, ExpireJobInterval: 1, Suffix: "burst"}})
+	ctx := context.Background()
+
+	// Limiter used before Init fails open
+	if lctx, err := lmt.LimitReached(ctx, "203.0.113.1"); err != nil || lctx.Reached {
+		t.Fatalf("Uninitialised limiter doesn't fail open: %+v, %v", lctx, err)
+	}
+	if lctx, err := lmt.PluggableLimitReached(ctx, "203.0.113.1"); err != nil || lctx.Reached {
+		t.Fatalf("Uninitialised pluggable limiter doesn't fail open: %+v, %v", lctx, err)
+	}
+
+	lmt.SetStrictInit(true)
+	if _, err := lmt.LimitReached(ctx, "203.0.113.1"); !errors.Is(err, limiter.ErrNotInitialised) {
+		t.Fatalf("Strict limiter is used before Init: %v", err)
+	}
+	if _, err := lmt.PluggableLimitReached(ctx, "203.0.113.1"); !errors.Is(err, limiter.ErrNotInitialised) {
+		t.Fatalf("Strict pluggable limiter is used before Init: %v", err)
+	}
+}
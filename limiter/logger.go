@@ -0,0 +1,160 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level of the log entry
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (lv Level) String() string {
+	switch lv {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(lv))
+}
+
+// Field is a key value pair of the log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns field of the key & value
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger records rejections, store failures & configuration reloads,
+// set via LimiterOptions.Logger. Implementations must be safe for concurrent use.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// Global logger, nothing is logged unless set. Holds loggerValue, since
+// atomic.Value requires values of the same concrete type.
+var logger atomic.Value
+
+type loggerValue struct {
+	Logger
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...Field) {}
+
+// GetLogger returns the logger set via LimiterOptions.Logger
+func GetLogger() Logger {
+	if v, ok := logger.Load().(loggerValue); ok {
+		return v.Logger
+	}
+	return nopLogger{}
+}
+
+// SetLogger for setting the global logger, nil disables logging.
+// Safe for concurrent use with requests being logged.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger.Store(loggerValue{Logger: l})
+}
+
+// stdLogger adapts the standard log package
+type stdLogger struct {
+	l   *log.Logger
+	min Level
+}
+
+// NewStdLogger adapts log.Logger, entries below min level are dropped.
+// Entries are formatted as `level msg key=value ...`, nil logs via log.Default.
+func NewStdLogger(l *log.Logger, min Level) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return stdLogger{l: l, min: min}
+}
+
+func (s stdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < s.min {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, fieldValue(f.Value))
+	}
+	s.l.Print(b.String())
+}
+
+// jsonLogger writes structured entries as JSON lines
+type jsonLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+// NewJSONLogger is a levelled structured logger writing an entry per line,
+// e.g. {"time":"...","level":"info","msg":"request rate limited","policy":"api"}.
+// Entries below min level are dropped.
+func NewJSONLogger(w io.Writer, min Level) Logger {
+	return &jsonLogger{w: w, min: min}
+}
+
+func (j *jsonLogger) Log(level Level, msg string, fields ...Field) {
+	if level < j.min {
+		return
+	}
+
+	entry := make(map[string]interface{}, len(fields)+3)
+	for _, f := range fields {
+		entry[f.Key] = fieldValue(f.Value)
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, _ = j.w.Write(append(line, '\n'))
+}
+
+// fieldValue formats errors & durations which don't marshal readably
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	}
+	return v
+}
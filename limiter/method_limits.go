@@ -0,0 +1,50 @@
+package limiter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Prefix of methods on the keys, e.g. <request key>|method:POST
+const MethodKeyPrefix = "method:"
+
+// SetMethodLimits for setting request limits per HTTP method, so that reads &
+// writes on the same route are limited independently. Methods without limits
+// are limited by the default limits of the limiter. Requests are limited by both
+// plan & method limits if both apply.
+func (l *Limiter) SetMethodLimits(limits map[string]ExpirableOptions) *Limiter {
+	methodLimits := make(map[string]ExpirableOptions, len(limits))
+	for method, eo := range limits {
+		methodLimits[strings.ToUpper(method)] = eo
+	}
+	// Method is used as suffix on the keys
+	l.methodLimits = newPluggableSet(MethodKeyPrefix, methodLimits)
+	return l
+}
+
+// GetMethodLimits returns request limits per HTTP method
+func (l *Limiter) GetMethodLimits() map[string]ExpirableOptions {
+	return l.methodLimits.options()
+}
+
+// GetLimitedMethod returns method of the request if it has method limits
+func (l *Limiter) GetLimitedMethod(r *http.Request) string {
+	if _, exists := l.methodLimits[r.Method]; exists {
+		return r.Method
+	}
+	return ""
+}
+
+// MethodLimitReached limits key by the limits of the given method,
+// defaults to the limits of the limiter for methods without limits
+func (l *Limiter) MethodLimitReached(ctx context.Context, method, key string) (Context, error) {
+	p, exists := l.methodLimits[method]
+	if !exists {
+		return l.LimitReached(ctx, key)
+	}
+	if !l.IsInitialised() {
+		return l.notInitialised()
+	}
+	return l.pluggableLimiterValidator(ctx, p, TierMethod, key)
+}
@@ -0,0 +1,64 @@
+package limiter
+
+import (
+	"net/http"
+)
+
+// Observer is notified of the outcome of every request limited by LimitByRequest,
+// e.g. for logging, alerting or analytics. Keys are nil for requests rejected
+// before building keys, e.g. by deny list. Observers are invoked synchronously.
+// Requests allowed in shadow mode are passed to OnAllow with Context.Shadow set.
+type Observer interface {
+	OnAllow(r *http.Request, keys *LimiterKeys, lmtCtx Context)
+	OnReject(r *http.Request, keys *LimiterKeys, lmtCtx Context)
+	OnError(r *http.Request, keys *LimiterKeys, err error)
+	OnSkip(r *http.Request)
+}
+
+// ObserverFuncs implements Observer via optional funcs
+type ObserverFuncs struct {
+	Allow  func(r *http.Request, keys *LimiterKeys, lmtCtx Context)
+	Reject func(r *http.Request, keys *LimiterKeys, lmtCtx Context)
+	Error  func(r *http.Request, keys *LimiterKeys, err error)
+	Skip   func(r *http.Request)
+}
+
+func (o ObserverFuncs) OnAllow(r *http.Request, keys *LimiterKeys, lmtCtx Context) {
+	if o.Allow != nil {
+		o.Allow(r, keys, lmtCtx)
+	}
+}
+
+func (o ObserverFuncs) OnReject(r *http.Request, keys *LimiterKeys, lmtCtx Context) {
+	if o.Reject != nil {
+		o.Reject(r, keys, lmtCtx)
+	}
+}
+
+func (o ObserverFuncs) OnError(r *http.Request, keys *LimiterKeys, err error) {
+	if o.Error != nil {
+		o.Error(r, keys, err)
+	}
+}
+
+func (o ObserverFuncs) OnSkip(r *http.Request) {
+	if o.Skip != nil {
+		o.Skip(r)
+	}
+}
+
+// SetObservers for setting observers notified of the outcome of requests
+func (l *Limiter) SetObservers(observers ...Observer) *Limiter {
+	l.observers = observers
+	return l
+}
+
+// AddObserver for adding observer notified of the outcome of requests
+func (l *Limiter) AddObserver(observer Observer) *Limiter {
+	l.observers = append(append([]Observer{}, l.observers...), observer)
+	return l
+}
+
+func (l *Limiter) GetObservers() []Observer {
+	return l.observers
+}
@@ -26,6 +26,8 @@ type LimiterOptions struct {
 	FuncAdditionalContext FuncFetchParamFromContext
 	Redis                 *libredis.Options
 	Prefix                string
+	// Logger records rejections, store failures & configuration reloads
+	Logger Logger
 }
 
 // ExpirableOptions are options used for new limiter creation
@@ -33,6 +35,9 @@ type ExpirableOptions struct {
 	DefaultExpirationTTL time.Duration
 	ExpireJobInterval    int64
 	Suffix               string
+	// Limits are evaluated without being enforced, valid for pluggable
+	// limiters, plans, methods & user global limits. See SetShadow
+	Shadow bool
 }
 
 // Context is the limit context.
@@ -41,6 +46,24 @@ type Context struct {
 	Remaining int64
 	Reset     int64
 	Reached   bool
+	// Request is allowed, but would have been rejected by a tier in shadow mode, see ShadowTier
+	Shadow bool
+	// Request is rejected by deny list or missing identity policy, without consulting the store
+	Denied bool
+	// Plan of the request, if limited by plan limits
+	Plan string
+
+	// Tier deciding the outcome, see TierGlobal etc. along with the suffix
+	// of the pluggable limiter, plan or method & the key passed to the store
+	Tier, Suffix, Key string
+	// Name of the limiter, see SetName
+	Policy string
+	// Time until the limit resets, if reached
+	RetryAfter time.Duration
+	// Reset as time
+	ResetAt time.Time
+	// Limit context of every tier evaluated, in order
+	Tiers []TierContext
 }
 
 func (c *Context) LimitReached() bool {
@@ -50,13 +73,35 @@ func (c *Context) LimitReached() bool {
 type LimiterKeysValue []string
 
 type LimiterKeys struct {
-	Global, Request LimiterKeysValue
+	Global  LimiterKeysValue `json:"global,omitempty"`
+	Request LimiterKeysValue `json:"request,omitempty"`
+	// Keys of pluggable limits, global key or user key of authenticated requests
+	Pluggable LimiterKeysValue `json:"pluggable,omitempty"`
+	// Global keys of authenticated requests, per user & per ip
+	User                LimiterKeysValue `json:"user,omitempty"`
+	AuthenticatedGlobal LimiterKeysValue `json:"authenticated_global,omitempty"`
+	// Plan to limit request keys by, empty for default limits
+	Plan string `json:"plan,omitempty"`
+	// Method to limit request keys by, if method has its own limits
+	Method string `json:"method,omitempty"`
 }
 
 func (l *LimiterKeys) IsGlobalValid() bool {
 	return len(l.Global) > 0
 }
 
+func (l *LimiterKeys) IsPluggableValid() bool {
+	return len(l.Pluggable) > 0
+}
+
+func (l *LimiterKeys) IsUserValid() bool {
+	return len(l.User) > 0
+}
+
+func (l *LimiterKeys) IsAuthenticatedGlobalValid() bool {
+	return len(l.AuthenticatedGlobal) > 0
+}
+
 func LimitByKeys(ctx context.Context, lmt *Limiter, keys []string) (Context, error) {
 	return lmt.LimitReached(ctx, strings.Join(keys, KeyJoinIdentifier))
 }
@@ -67,6 +112,14 @@ func (lv LimiterKeysValue) GlobalLimits(ctx context.Context, lmt *Limiter) (Cont
 	return lmt.GlobalLimitReached(ctx, strings.Join(lv, KeyJoinIdentifier))
 }
 
+func (lv LimiterKeysValue) UserGlobalLimits(ctx context.Context, lmt *Limiter) (Context, error) {
+	return lmt.UserGlobalLimitReached(ctx, strings.Join(lv, KeyJoinIdentifier))
+}
+
+func (lv LimiterKeysValue) AuthenticatedGlobalLimits(ctx context.Context, lmt *Limiter) (Context, error) {
+	return lmt.AuthenticatedGlobalLimitReached(ctx, strings.Join(lv, KeyJoinIdentifier))
+}
+
 func (lv LimiterKeysValue) PluggableLimits(ctx context.Context, lmt *Limiter) (Context, error) {
 	return lmt.PluggableLimitReached(ctx, strings.Join(lv, KeyJoinIdentifier))
 }
@@ -74,3 +127,15 @@ func (lv LimiterKeysValue) PluggableLimits(ctx context.Context, lmt *Limiter) (C
 func (lv LimiterKeysValue) Limits(ctx context.Context, lmt *Limiter) (Context, error) {
 	return lmt.LimitReached(ctx, strings.Join(lv, KeyJoinIdentifier))
 }
+
+func (lv LimiterKeysValue) MethodLimits(ctx context.Context, lmt *Limiter, method string) (Context, error) {
+	return lmt.MethodLimitReached(ctx, method, strings.Join(lv, KeyJoinIdentifier))
+}
+
+func (lv LimiterKeysValue) OverrideLimits(ctx context.Context, lmt *Limiter, o *Override, plan, method string) (Context, error) {
+	return lmt.OverrideLimitReached(ctx, o, plan, method, strings.Join(lv, KeyJoinIdentifier))
+}
+
+func (lv LimiterKeysValue) PlanLimits(ctx context.Context, lmt *Limiter, plan string) (Context, error) {
+	return lmt.PlanLimitReached(ctx, plan, strings.Join(lv, KeyJoinIdentifier))
+}
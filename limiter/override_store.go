@@ -0,0 +1,226 @@
+package limiter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alter123/go-ratelimit/libstring"
+	libredis "github.com/redis/go-redis/v9"
+)
+
+// OverrideKeySuffix is suffixed to the store prefix on keys of overrides,
+// so that overrides are not listed along with the counters
+const OverrideKeySuffix = "-overrides"
+
+// DefaultOverrideCacheTTL is the duration lookups of overrides are cached for,
+// so that requests don't read the store on every lookup
+const DefaultOverrideCacheTTL = time.Second
+
+// Maximum number of cached lookups, the cache is cleared once exceeded
+const maxCachedOverrides = 10000
+
+// RedisOverrideStore holds overrides on redis, shared across the instances.
+// Overrides are stored as JSON on keys formatted as prefix:policy|identity,
+// which expire along with the overrides.
+type RedisOverrideStore struct {
+	client *libredis.Client
+	prefix string
+
+	// Lookups are cached per instance, overrides set or deleted by other
+	// instances take effect once cached lookups expire
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	cache    map[string]cachedOverride
+}
+
+type cachedOverride struct {
+	o         *Override
+	expiresAt time.Time
+}
+
+// NewRedisOverrideStore holds overrides on redis, keys are prefixed by prefix.
+// Lookups are cached for DefaultOverrideCacheTTL.
+func NewRedisOverrideStore(client *libredis.Client, prefix string) *RedisOverrideStore {
+	return &RedisOverrideStore{client: client, prefix: prefix, cacheTTL: DefaultOverrideCacheTTL}
+}
+
+// SetCacheTTL for setting the duration lookups are cached for, zero disables the cache
+func (s *RedisOverrideStore) SetCacheTTL(ttl time.Duration) *RedisOverrideStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheTTL, s.cache = ttl, nil
+	return s
+}
+
+func (s *RedisOverrideStore) GetCacheTTL() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cacheTTL
+}
+
+// cached returns cached lookup of the key, if cached lookup is not expired
+func (s *RedisOverrideStore) cached(key string, now time.Time) (*Override, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cache[key]
+	if !ok || !c.expiresAt.After(now) {
+		return nil, false
+	}
+	if c.o != nil && c.o.Expired(now) {
+		return nil, true
+	}
+	return c.o, true
+}
+
+func (s *RedisOverrideStore) setCached(key string, o *Override, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cacheTTL <= 0 {
+		return
+	}
+	if s.cache == nil || len(s.cache) >= maxCachedOverrides {
+		s.cache = map[string]cachedOverride{}
+	}
+	s.cache[key] = cachedOverride{o: o, expiresAt: now.Add(s.cacheTTL)}
+}
+
+// clearCache drops cached lookups, so that changes of the instance take effect immediately
+func (s *RedisOverrideStore) clearCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = nil
+}
+
+// NewStoreOverrides holds overrides on the store initialised via Init,
+// keys are prefixed by LimiterOptions.Prefix along with OverrideKeySuffix
+func NewStoreOverrides() (*RedisOverrideStore, error) {
+	if redisClient == nil {
+		return nil, ErrNotInitialised
+	}
+	return NewRedisOverrideStore(redisClient, storePrefix+OverrideKeySuffix), nil
+}
+
+func (s *RedisOverrideStore) key(policy, identity string) string {
+	return s.prefix + ":" + policy + KeyJoinIdentifier + identity
+}
+
+func (s *RedisOverrideStore) Lookup(ctx context.Context, policy string, identities ...string) (*Override, error) {
+	var keys []string
+	for _, p := range overridePolicies(policy) {
+		for _, identity := range identities {
+			keys = append(keys, s.key(p, identity))
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	cacheKey := strings.Join(keys, "\n")
+	if o, ok := s.cached(cacheKey, now); ok {
+		return o, nil
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Override
+	for _, v := range values {
+		o, err := decodeOverride(v)
+		if err != nil {
+			return nil, err
+		}
+		if o != nil && !o.Expired(now) {
+			found = o
+			break
+		}
+	}
+	// Missing overrides are cached as well, since most identities have none
+	s.setCached(cacheKey, found, now)
+	return found, nil
+}
+
+func (s *RedisOverrideStore) Set(ctx context.Context, o Override) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	ttl := time.Until(o.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("%w: override is expired", ErrInvalidConfig)
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	defer s.clearCache()
+	return s.client.Set(ctx, s.key(o.Policy, o.Identity), data, ttl).Err()
+}
+
+func (s *RedisOverrideStore) Delete(ctx context.Context, policy, identity string) error {
+	defer s.clearCache()
+	return s.client.Del(ctx, s.key(policy, identity)).Err()
+}
+
+func (s *RedisOverrideStore) List(ctx context.Context, policy string) ([]Override, error) {
+	match := libstring.EscapePattern(s.prefix+":") + "*"
+	if policy != "" {
+		match = libstring.EscapePattern(s.prefix+":"+policy+KeyJoinIdentifier) + "*"
+	}
+
+	seen := map[string]bool{}
+	var keys []string
+	iter := s.client.Scan(ctx, 0, match, 100).Iterator()
+	for iter.Next(ctx) {
+		if !seen[iter.Val()] {
+			seen[iter.Val()] = true
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	overrides := []Override{}
+	if len(keys) == 0 {
+		return overrides, nil
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, v := range values {
+		o, err := decodeOverride(v)
+		if err != nil {
+			return nil, err
+		}
+		// Policy is validated as well, since policy may contain KeyJoinIdentifier
+		if o != nil && !o.Expired(now) && (policy == "" || o.Policy == policy) {
+			overrides = append(overrides, *o)
+		}
+	}
+	sortOverrides(overrides)
+	return overrides, nil
+}
+
+// decodeOverride decodes override of MGET value, nil if the key doesn't exist
+func decodeOverride(v interface{}) (*Override, error) {
+	data, ok := v.(string)
+	if !ok || strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var o Override
+	if err := json.Unmarshal([]byte(data), &o); err != nil {
+		return nil, fmt.Errorf("decode override: %w", err)
+	}
+	return &o, nil
+}
@@ -0,0 +1,58 @@
+package limiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mockredis "github.com/alicebob/miniredis/v2"
+	"github.com/alter123/go-ratelimit/limiter"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOverrideCache(t *testing.T) {
+	mr, err := mockredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	cached := limiter.NewRedisOverrideStore(client, "cached").SetCacheTTL(time.Minute)
+	other := limiter.NewRedisOverrideStore(client, "cached")
+	ctx := context.Background()
+
+	if err = other.Set(ctx, limiter.MultiplierOverride("api", "203.0.113.30", 2, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := cached.Lookup(ctx, "api", "203.0.113.30"); err != nil || o == nil || o.Multiplier != 2 {
+		t.Fatalf("Override is not looked up: %+v, %v", o, err)
+	}
+
+	// Lookups are served from the cache, until changed by the instance
+	if err = other.Delete(ctx, "api", "203.0.113.30"); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := cached.Lookup(ctx, "api", "203.0.113.30"); err != nil || o == nil {
+		t.Fatalf("Lookup of override is not cached: %+v, %v", o, err)
+	}
+	if err = cached.Delete(ctx, "api", "203.0.113.30"); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := cached.Lookup(ctx, "api", "203.0.113.30"); err != nil || o != nil {
+		t.Fatalf("Deleted override is looked up: %+v, %v", o, err)
+	}
+
+	// Missing overrides are cached as well
+	if err = other.Set(ctx, limiter.MultiplierOverride("api", "203.0.113.30", 3, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := cached.Lookup(ctx, "api", "203.0.113.30"); err != nil || o != nil {
+		t.Fatalf("Lookup of missing override is not cached: %+v, %v", o, err)
+	}
+	if o, err := cached.SetCacheTTL(0).Lookup(ctx, "api", "203.0.113.30"); err != nil || o == nil || o.Multiplier != 3 {
+		t.Fatalf("Override is looked up from the cache: %+v, %v", o, err)
+	}
+}
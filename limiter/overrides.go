@@ -0,0 +1,246 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	limiterlib "github.com/ulule/limiter/v3"
+)
+
+// Override of the request limits of an identity, e.g. user id or ip, until expiry.
+// Limits are either absolute, or a multiplier of the request limits which would
+// apply otherwise. Empty policy applies to all the limiters sharing the override store.
+type Override struct {
+	Policy   string        `json:"policy,omitempty"`
+	Identity string        `json:"identity"`
+	Limit    int64         `json:"limit,omitempty"`
+	Period   time.Duration `json:"period,omitempty"`
+	// Multiplier of the request limits, e.g. 5 for 5x limits, over the same period
+	Multiplier float64   `json:"multiplier,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// AbsoluteOverride overrides request limits of the identity with limit per period for ttl
+func AbsoluteOverride(policy, identity string, limit int64, period, ttl time.Duration) Override {
+	return Override{Policy: policy, Identity: identity, Limit: limit, Period: period, ExpiresAt: time.Now().Add(ttl)}
+}
+
+// MultiplierOverride multiplies request limits of the identity by multiplier for ttl
+func MultiplierOverride(policy, identity string, multiplier float64, ttl time.Duration) Override {
+	return Override{Policy: policy, Identity: identity, Multiplier: multiplier, ExpiresAt: time.Now().Add(ttl)}
+}
+
+// Validate validates that identity & either limit with period or multiplier of the override are set
+func (o *Override) Validate() error {
+	switch {
+	case o.Identity == "":
+		return fmt.Errorf("%w: override identity is required", ErrInvalidConfig)
+	case o.Multiplier < 0:
+		return fmt.Errorf("%w: override multiplier must be positive", ErrInvalidConfig)
+	case o.Multiplier > 0 && (o.Limit != 0 || o.Period != 0):
+		return fmt.Errorf("%w: override is either limit with period or multiplier", ErrInvalidConfig)
+	case o.Multiplier > 0:
+		return nil
+	case o.Limit <= 0:
+		return fmt.Errorf("%w: override limit must be positive", ErrInvalidConfig)
+	case o.Period <= 0:
+		return fmt.Errorf("%w: override period must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Rate of the override, multiplier is applied on the base limits
+func (o *Override) Rate(base ExpirableOptions) limiterlib.Rate {
+	if o.Multiplier <= 0 {
+		return limiterlib.Rate{Limit: o.Limit, Period: o.Period}
+	}
+
+	limit := int64(math.Ceil(float64(base.ExpireJobInterval) * o.Multiplier))
+	if limit < 1 {
+		limit = 1
+	}
+	return limiterlib.Rate{Limit: limit, Period: base.DefaultExpirationTTL}
+}
+
+// Expired validates if override is expired at the time
+func (o *Override) Expired(now time.Time) bool {
+	return !o.ExpiresAt.After(now)
+}
+
+// OverrideStore holds overrides of the request limits, consulted by LimitByRequest
+type OverrideStore interface {
+	// Lookup returns first override of the policy matching identities in order,
+	// overrides of the policy take precedence over ones of all the policies
+	Lookup(ctx context.Context, policy string, identities ...string) (*Override, error)
+	Set(ctx context.Context, o Override) error
+	Delete(ctx context.Context, policy, identity string) error
+	// List returns overrides which are not expired, all of them if policy is empty
+	List(ctx context.Context, policy string) ([]Override, error)
+}
+
+// MemoryOverrideStore holds overrides in memory, valid only for a single instance
+type MemoryOverrideStore struct {
+	mu        sync.RWMutex
+	overrides map[[2]string]Override
+}
+
+func NewMemoryOverrideStore() *MemoryOverrideStore {
+	return &MemoryOverrideStore{overrides: map[[2]string]Override{}}
+}
+
+func (s *MemoryOverrideStore) Lookup(ctx context.Context, policy string, identities ...string) (*Override, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range overridePolicies(policy) {
+		for _, identity := range identities {
+			if o, ok := s.overrides[[2]string{p, identity}]; ok && !o.Expired(now) {
+				return &o, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryOverrideStore) Set(ctx context.Context, o Override) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides[[2]string{o.Policy, o.Identity}] = o
+	return nil
+}
+
+func (s *MemoryOverrideStore) Delete(ctx context.Context, policy, identity string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.overrides, [2]string{policy, identity})
+	return nil
+}
+
+func (s *MemoryOverrideStore) List(ctx context.Context, policy string) ([]Override, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overrides := []Override{}
+	for k, o := range s.overrides {
+		if o.Expired(now) {
+			delete(s.overrides, k)
+			continue
+		}
+		if policy == "" || o.Policy == policy {
+			overrides = append(overrides, o)
+		}
+	}
+	sortOverrides(overrides)
+	return overrides, nil
+}
+
+// overridePolicies returns policies to look up overrides of, in order of precedence
+func overridePolicies(policy string) []string {
+	if policy == "" {
+		return []string{""}
+	}
+	return []string{policy, ""}
+}
+
+func sortOverrides(overrides []Override) {
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Policy != overrides[j].Policy {
+			return overrides[i].Policy < overrides[j].Policy
+		}
+		return overrides[i].Identity < overrides[j].Identity
+	})
+}
+
+// SetOverrides for setting store of overrides of the request limits per identity
+func (l *Limiter) SetOverrides(store OverrideStore) *Limiter {
+	l.overrides = store
+	return l
+}
+
+func (l *Limiter) GetOverrides() OverrideStore {
+	return l.overrides
+}
+
+// LookupOverride returns override of the request limits for user id or remote
+// ip of the request, in the order. Masked ip is looked up if ip mask is set.
+func (l *Limiter) LookupOverride(r *http.Request) (*Override, error) {
+	if l.overrides == nil {
+		return nil, nil
+	}
+
+	var identities []string
+	if l.GetIncludeUserId() {
+		if userId, err := l.GetUserId(r); err == nil && userId != "" {
+			identities = append(identities, userId)
+		}
+	}
+	if ip := l.RemoteIP(r); ip != "" {
+		identities = append(identities, ip)
+		if masked := l.GetIPMask().Apply(ip); masked != ip {
+			identities = append(identities, masked)
+		}
+	}
+	if len(identities) == 0 {
+		return nil, nil
+	}
+
+	o, err := l.overrides.Lookup(r.Context(), l.name, identities...)
+	if err != nil {
+		return nil, storeError(TierOverride, strings.Join(identities, KeyJoinIdentifier), err)
+	}
+	return o, nil
+}
+
+// OverrideLimitReached limits the key by the override, multiplier is applied on the
+// limits of the plan or method if set. Counters of overrides are independent of the request limits.
+func (l *Limiter) OverrideLimitReached(ctx context.Context, o *Override, plan, method, key string) (Context, error) {
+	if redisStore == nil {
+		return l.notInitialised()
+	}
+
+	rate := o.Rate(l.requestLimits(plan, method))
+	key = l.overrideKey(key, plan, method)
+	lctx, err := l.storeGet(ctx, limiterlib.New(redisStore, rate), TierOverride, o.Identity, key, l.shadow)
+	if err != nil {
+		return Context{}, err
+	}
+	lctx.Plan = plan
+	return lctx, nil
+}
+
+// overrideKey returns key of the override counter, formatted as
+// <request key>|override[|plan:name][|method:name], so that the override is
+// counted per limit it replaces
+func (l *Limiter) overrideKey(key, plan, method string) string {
+	parts := []string{key, TierOverride}
+	if _, exists := l.plans[plan]; exists {
+		parts = append(parts, PlanKeyPrefix+plan)
+	}
+	if _, exists := l.methodLimits[method]; exists {
+		parts = append(parts, MethodKeyPrefix+method)
+	}
+	return strings.Join(parts, KeyJoinIdentifier)
+}
+
+// requestLimits returns limits applied on request key, by precedence of plan & method
+func (l *Limiter) requestLimits(plan, method string) ExpirableOptions {
+	if p, exists := l.plans[plan]; exists {
+		return p.E
+	}
+	if p, exists := l.methodLimits[method]; exists {
+		return p.E
+	}
+	return l.expiry
+}
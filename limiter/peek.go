@@ -0,0 +1,20 @@
+package limiter
+
+import (
+	"context"
+)
+
+type peekKey struct{}
+
+// PeekContext returns context on which limits are evaluated without consuming
+// quota, e.g. to explain decision of a request. Store counters are read without
+// being incremented & reached tiers don't stop the evaluation of next tiers.
+func PeekContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peekKey{}, true)
+}
+
+// IsPeek validates if limits are evaluated without consuming quota, see PeekContext
+func IsPeek(ctx context.Context) bool {
+	peek, _ := ctx.Value(peekKey{}).(bool)
+	return peek
+}
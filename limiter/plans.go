@@ -0,0 +1,72 @@
+package limiter
+
+import (
+	"context"
+	"net/http"
+)
+
+// Prefix of plan names on the keys, e.g. <request key>|plan:pro
+const PlanKeyPrefix = "plan:"
+
+// FuncResolvePlan resolves the plan of the request, e.g. free, pro or enterprise.
+// User id is resolved from the identity sources, empty if not present.
+type FuncResolvePlan func(r *http.Request, userId string) (string, error)
+
+// SetPlanResolver for setting helper function to resolve plan of the request
+func (l *Limiter) SetPlanResolver(f FuncResolvePlan) *Limiter {
+	l.planResolver = f
+	return l
+}
+
+// SetPlans for setting request limits per plan, requests of unknown plans
+// are limited by the default limits of the limiter
+func (l *Limiter) SetPlans(plans map[string]ExpirableOptions) *Limiter {
+	// Plan name is used as suffix on the keys
+	l.plans = newPluggableSet(PlanKeyPrefix, plans)
+	return l
+}
+
+// GetPlans returns request limits per plan
+func (l *Limiter) GetPlans() map[string]ExpirableOptions {
+	return l.plans.options()
+}
+
+// GetPlan resolves plan of the request, empty if plan is not resolved or unknown
+func (l *Limiter) GetPlan(r *http.Request) string {
+	if l.planResolver == nil || len(l.plans) == 0 {
+		return ""
+	}
+
+	userId := ""
+	if l.GetIncludeUserId() {
+		userId, _ = l.GetUserId(r)
+	}
+
+	plan, err := l.planResolver(r, userId)
+	if err != nil {
+		return ""
+	}
+	if _, exists := l.plans[plan]; !exists {
+		return ""
+	}
+	return plan
+}
+
+// PlanLimitReached limits key by the limits of the given plan,
+// defaults to the limits of the limiter for unknown plans
+func (l *Limiter) PlanLimitReached(ctx context.Context, plan, key string) (Context, error) {
+	p, exists := l.plans[plan]
+	if !exists {
+		return l.LimitReached(ctx, key)
+	}
+	if !l.IsInitialised() {
+		return l.notInitialised()
+	}
+
+	lctx, err := l.pluggableLimiterValidator(ctx, p, TierPlan, key)
+	if err != nil {
+		return Context{}, err
+	}
+	lctx.Plan = plan
+	return lctx, nil
+}
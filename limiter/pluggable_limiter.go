@@ -19,22 +19,41 @@ type Pluggable struct {
 func NewPluggableLimiter(eo []ExpirableOptions) *PluggableLimiter {
 	pl := make(PluggableLimiter, len(eo))
 	for i, e := range eo {
-		ll := &limiterlib.Limiter{
-			Store: redisStore,
-			Rate: limiterlib.Rate{
-				Period: e.DefaultExpirationTTL,
-				Limit:  e.ExpireJobInterval,
-			},
-		}
-
-		pl[i] = Pluggable{
-			E: e,
-			L: ll,
-		}
+		pl[i] = newPluggable(e)
 	}
 	return &pl
 }
 
+// pluggableSet are limiters by name, name prefixed by the namespace of the
+// set is used as suffix on the keys, e.g. plan:pro. Namespaces keep the keys of
+// sets apart, so that a plan named after a method doesn't share its counter.
+type pluggableSet map[string]*Pluggable
+
+func newPluggableSet(namespace string, eo map[string]ExpirableOptions) pluggableSet {
+	ps := make(pluggableSet, len(eo))
+	for name, e := range eo {
+		e.Suffix = namespace + name
+		p := newPluggable(e)
+		ps[name] = &p
+	}
+	return ps
+}
+
+func (ps pluggableSet) options() map[string]ExpirableOptions {
+	eo := make(map[string]ExpirableOptions, len(ps))
+	for name, p := range ps {
+		eo[name] = p.E
+	}
+	return eo
+}
+
+func newPluggable(e ExpirableOptions) Pluggable {
+	return Pluggable{
+		E: e,
+		L: newStoreLimiter(e),
+	}
+}
+
 func (l *Limiter) IsPluggableLimiterValid() (isValid bool) {
 	if l.pluggableLimiter == nil {
 		return
@@ -54,14 +73,21 @@ func (l *Limiter) IsPluggableLimiterValid() (isValid bool) {
 
 func (l *Limiter) PluggableLimitReached(ctx context.Context, key string) (lctx Context, err error) {
 	if !l.IsPluggableLimiterValid() {
+		if l.pluggableLimiter != nil && !l.IsInitialised() {
+			return l.notInitialised()
+		}
 		return Context{}, nil
 	}
 
+	// Breakdown of all the pluggable limiters evaluated
+	var tiers []TierContext
 	for _, p := range *l.pluggableLimiter {
-		lctx, err = l.pluggableLimiterValidator(ctx, &p, key)
+		lctx, err = l.pluggableLimiterValidator(ctx, &p, TierPluggable, key)
 		if err != nil {
 			return
 		}
+		tiers = append(tiers, lctx.Tiers...)
+		lctx.Tiers = tiers
 		if lctx.LimitReached() {
 			return
 		}
@@ -69,17 +95,13 @@ func (l *Limiter) PluggableLimitReached(ctx context.Context, key string) (lctx C
 	return
 }
 
-func (l *Limiter) pluggableLimiterValidator(ctx context.Context, p *Pluggable, key string) (lctx Context, err error) {
+func (l *Limiter) pluggableLimiterValidator(ctx context.Context, p *Pluggable, tier, key string) (lctx Context, err error) {
 	if p.E.Suffix == "" {
 		return
 	}
 	if p.L.Store == nil {
 		return
 	}
-	lctxi, lerr := p.L.Get(ctx, strings.Join([]string{key, p.E.Suffix}, KeyJoinIdentifier))
-	if lerr != nil {
-		return Context{}, lerr
-	}
-	lctx = Context(lctxi)
-	return
+	key = strings.Join([]string{key, p.E.Suffix}, KeyJoinIdentifier)
+	return l.storeGet(ctx, p.L, tier, p.E.Suffix, key, l.shadow || p.E.Shadow)
 }
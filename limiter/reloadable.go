@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Reloadable holds limiter which can be swapped atomically at runtime, e.g. to
+// tighten limits during an incident. Counters are retained in the store as
+// long as the keys of the new limiter don't change.
+type Reloadable struct {
+	value atomic.Value
+	// Serializes updates, readers are lock free
+	mu sync.Mutex
+}
+
+// NewReloadable creates reloadable limiter
+func NewReloadable(l *Limiter) *Reloadable {
+	rl := &Reloadable{}
+	rl.value.Store(l)
+	return rl
+}
+
+// Load returns the current limiter, which must not be modified
+func (rl *Reloadable) Load() *Limiter {
+	return rl.value.Load().(*Limiter)
+}
+
+// Store swaps the current limiter, in-flight requests complete with the previous one
+func (rl *Reloadable) Store(l *Limiter) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.value.Store(l)
+}
+
+// Update applies setters on the copy of the current limiter & swaps it
+func (rl *Reloadable) Update(f func(l *Limiter)) *Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	next := rl.Load().Clone()
+	f(next)
+	rl.value.Store(next)
+	return next
+}
+
+// Clone returns copy of the limiter, which can be modified via setters
+// without affecting the limiter
+func (l *Limiter) Clone() *Limiter {
+	next := *l
+
+	// Setters replace slices & maps, except methods which are updated in place
+	if l.methods != nil {
+		next.methods = make(map[string]bool, len(l.methods))
+		for method, enabled := range l.methods {
+			next.methods[method] = enabled
+		}
+	}
+	return &next
+}
@@ -0,0 +1,128 @@
+package limiter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Default key to bucket requests without identity, see MissingIdentityFallback
+const DefaultMissingIdentityKey = "anonymous"
+
+// Skipper decides if request should bypass the limiter, e.g. health checks
+type Skipper func(r *http.Request) bool
+
+// MissingIdentityPolicy decides the outcome of requests without ip & user id
+type MissingIdentityPolicy int
+
+const (
+	// Requests without identity bypass the limiter
+	MissingIdentitySkip MissingIdentityPolicy = iota
+	// Requests without identity are rejected outright
+	MissingIdentityReject
+	// Requests without identity are limited under a shared fallback key
+	MissingIdentityFallback
+)
+
+// SkipPaths skips requests with any of the given url paths
+func SkipPaths(paths ...string) Skipper {
+	pathSet := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		pathSet[path] = true
+	}
+	return func(r *http.Request) bool {
+		return pathSet[r.URL.Path]
+	}
+}
+
+// SkipPathPrefixes skips requests with url path starting with any of the given prefixes
+func SkipPathPrefixes(prefixes ...string) Skipper {
+	return func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipMethods skips requests with any of the given methods, e.g. OPTIONS
+func SkipMethods(methods ...string) Skipper {
+	methodSet := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		methodSet[strings.ToUpper(method)] = true
+	}
+	return func(r *http.Request) bool {
+		return methodSet[r.Method]
+	}
+}
+
+// SkipHeader skips requests with the given header set to any of the values,
+// or to any non-empty value if no values are given
+func SkipHeader(name string, values ...string) Skipper {
+	return func(r *http.Request) bool {
+		value := r.Header.Get(name)
+		if value == "" {
+			return false
+		}
+		if len(values) == 0 {
+			return true
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SetSkippers for setting rules to bypass the limiter
+func (l *Limiter) SetSkippers(skippers ...Skipper) *Limiter {
+	l.skippers = skippers
+	return l
+}
+
+// IsSkipped validates if request matches any of the skippers
+func (l *Limiter) IsSkipped(r *http.Request) bool {
+	for _, skipper := range l.skippers {
+		if skipper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMissingIdentityPolicy for setting the outcome of requests without ip & user id
+func (l *Limiter) SetMissingIdentityPolicy(policy MissingIdentityPolicy) *Limiter {
+	l.missingIdentityPolicy = policy
+	return l
+}
+
+func (l *Limiter) GetMissingIdentityPolicy() MissingIdentityPolicy {
+	return l.missingIdentityPolicy
+}
+
+// SetMissingIdentityKey for setting the shared key of requests without identity,
+// used as ip on the keys with MissingIdentityFallback policy
+func (l *Limiter) SetMissingIdentityKey(key string) *Limiter {
+	l.missingIdentityKey = key
+	return l
+}
+
+func (l *Limiter) GetMissingIdentityKey() string {
+	if l.missingIdentityKey == "" {
+		return DefaultMissingIdentityKey
+	}
+	return l.missingIdentityKey
+}
+
+// KeyRemoteIP finds IP address of the request to be used on keys,
+// falls back on missing identity key as per MissingIdentityFallback policy
+func (l *Limiter) KeyRemoteIP(r *http.Request) string {
+	remoteIP := l.RemoteIP(r)
+	if remoteIP == "" && l.GetMissingIdentityPolicy() == MissingIdentityFallback {
+		return l.GetMissingIdentityKey()
+	}
+	return remoteIP
+}
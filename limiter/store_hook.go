@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	limiterlib "github.com/ulule/limiter/v3"
+)
+
+// StoreHook is invoked after every call to the store with the tier, the
+// duration of the call & the store error if any, e.g. for latency metrics
+type StoreHook func(tier string, duration time.Duration, err error)
+
+// AddStoreHook for adding hook invoked after every call to the store
+func (l *Limiter) AddStoreHook(hook StoreHook) *Limiter {
+	l.storeHooks = append(append([]StoreHook{}, l.storeHooks...), hook)
+	return l
+}
+
+func (l *Limiter) GetStoreHooks() []StoreHook {
+	return l.storeHooks
+}
+
+// storeGet increments the key on the store, notifying the store hooks.
+// Reached limit doesn't reject the request in shadow mode.
+func (l *Limiter) storeGet(ctx context.Context, ll *limiterlib.Limiter, tier, suffix, key string, shadow bool) (Context, error) {
+	if IsPeek(ctx) {
+		return l.storePeek(ctx, ll, tier, suffix, key, shadow)
+	}
+
+	start := time.Now()
+	lctx, err := ll.Get(ctx, key)
+	if err != nil {
+		err = storeError(tier, key, err)
+	}
+	for _, hook := range l.storeHooks {
+		hook(tier, time.Since(start), err)
+	}
+	if err != nil {
+		return Context{}, err
+	}
+	c := newContext(lctx, tier, suffix, key)
+	if shadow {
+		c = c.Shadowed()
+	}
+	return c, nil
+}
+
+// storePeek reads the key on the store without incrementing it, the tier is
+// reached if the next request would be rejected. The context isn't reached so
+// that all the tiers are evaluated, reached tiers are reported via Tiers along
+// with their shadow mode. Store hooks are not notified.
+func (l *Limiter) storePeek(ctx context.Context, ll *limiterlib.Limiter, tier, suffix, key string, shadow bool) (Context, error) {
+	lctx, err := ll.Peek(ctx, key)
+	if err != nil {
+		return Context{}, storeError(tier, key, err)
+	}
+	lctx.Reached = lctx.Remaining <= 0
+	c := newContext(lctx, tier, suffix, key)
+	if shadow {
+		return c.Shadowed(), nil
+	}
+	c.Reached, c.RetryAfter = false, 0
+	return c, nil
+}
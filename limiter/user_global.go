@@ -0,0 +1,74 @@
+package limiter
+
+import (
+	"context"
+)
+
+const (
+	// Dimension prefixed to user id on user global keys
+	UserGlobalKeyPrefix = "user"
+	// Dimension prefixed to ip on global keys of authenticated requests
+	AuthenticatedGlobalKeyPrefix = "authenticated"
+)
+
+// SetUserGlobalLimits for limiting authenticated users across all the requests,
+// keyed by user id. Global limits are otherwise valid only for non logged in requests.
+func (l *Limiter) SetUserGlobalLimits(eo ExpirableOptions) *Limiter {
+	p := newPluggable(eo)
+	l.userGlobal = &p
+	return l
+}
+
+// GetUserGlobalLimits returns global limits per user, nil if not set
+func (l *Limiter) GetUserGlobalLimits() *ExpirableOptions {
+	if l.userGlobal == nil {
+		return nil
+	}
+	return &l.userGlobal.E
+}
+
+// SetAuthenticatedGlobalLimits for limiting authenticated requests per ip
+// across all the requests, with rates independent of the global limits
+func (l *Limiter) SetAuthenticatedGlobalLimits(eo ExpirableOptions) *Limiter {
+	p := newPluggable(eo)
+	l.authenticatedGlobal = &p
+	return l
+}
+
+// GetAuthenticatedGlobalLimits returns global limits per ip of authenticated requests, nil if not set
+func (l *Limiter) GetAuthenticatedGlobalLimits() *ExpirableOptions {
+	if l.authenticatedGlobal == nil {
+		return nil
+	}
+	return &l.authenticatedGlobal.E
+}
+
+// SetPluggableForAuthenticated for applying pluggable limits to authenticated
+// requests per user. Pluggable limits are otherwise valid only for non logged in requests.
+func (l *Limiter) SetPluggableForAuthenticated(apply bool) *Limiter {
+	l.pluggableForAuthenticated = apply
+	return l
+}
+
+func (l *Limiter) GetPluggableForAuthenticated() bool {
+	return l.pluggableForAuthenticated
+}
+
+func (l *Limiter) UserGlobalLimitReached(ctx context.Context, key string) (Context, error) {
+	return l.optionalLimitReached(ctx, l.userGlobal, TierUserGlobal, key)
+}
+
+func (l *Limiter) AuthenticatedGlobalLimitReached(ctx context.Context, key string) (Context, error) {
+	return l.optionalLimitReached(ctx, l.authenticatedGlobal, TierAuthenticatedGlobal, key)
+}
+
+func (l *Limiter) optionalLimitReached(ctx context.Context, p *Pluggable, tier, key string) (Context, error) {
+	if p == nil {
+		return Context{}, nil
+	}
+	if p.L.Store == nil {
+		return l.notInitialised()
+	}
+
+	return l.storeGet(ctx, p.L, tier, "", key, l.shadow || p.E.Shadow)
+}
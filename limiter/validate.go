@@ -0,0 +1,86 @@
+package limiter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate validates the limits of the limiter, returns error describing all the problems
+func (l *Limiter) Validate() error {
+	var problems []string
+	validate := func(name string, eo ExpirableOptions) {
+		if eo.ExpireJobInterval <= 0 {
+			problems = append(problems, fmt.Sprintf("%s limit must be positive, got %d", name, eo.ExpireJobInterval))
+		}
+		if eo.DefaultExpirationTTL <= 0 {
+			problems = append(problems, fmt.Sprintf("%s ttl must be positive, got %s", name, eo.DefaultExpirationTTL))
+		}
+	}
+
+	validate("request", l.expiry)
+	validate("global", l.globalExpiry)
+
+	if l.pluggableLimiter != nil {
+		suffixes := make(map[string]bool, len(*l.pluggableLimiter))
+		for i, p := range *l.pluggableLimiter {
+			if p.E.Suffix == "" {
+				problems = append(problems, fmt.Sprintf("pluggable limiter %d suffix is required", i))
+			} else if suffixes[p.E.Suffix] {
+				problems = append(problems, fmt.Sprintf("pluggable limiter %d suffix %q is duplicate", i, p.E.Suffix))
+			}
+			suffixes[p.E.Suffix] = true
+			validate(fmt.Sprintf("pluggable limiter %q", p.E.Suffix), p.E)
+		}
+	}
+
+	for name, p := range l.plans {
+		validate(fmt.Sprintf("plan %q", name), p.E)
+	}
+
+	for method, p := range l.methodLimits {
+		validate(fmt.Sprintf("method %q", method), p.E)
+	}
+
+	if l.userGlobal != nil {
+		validate("user global", l.userGlobal.E)
+	}
+	if l.authenticatedGlobal != nil {
+		validate("authenticated global", l.authenticatedGlobal.E)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Build validates the limiter & applies all the options. Limiters are rebuilt
+// on the store, so that limiters created before Init are enforced.
+func (l *Limiter) Build() (*Limiter, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	l.limiter = newStoreLimiter(l.expiry)
+	l.globalLimiter = newStoreLimiter(l.globalExpiry)
+
+	if l.pluggableLimiter != nil {
+		pl := make(PluggableLimiter, len(*l.pluggableLimiter))
+		for i, p := range *l.pluggableLimiter {
+			pl[i] = newPluggable(p.E)
+		}
+		l.pluggableLimiter = &pl
+	}
+
+	l.plans = newPluggableSet(PlanKeyPrefix, l.plans.options())
+	l.methodLimits = newPluggableSet(MethodKeyPrefix, l.methodLimits.options())
+
+	if l.userGlobal != nil {
+		l.SetUserGlobalLimits(l.userGlobal.E)
+	}
+	if l.authenticatedGlobal != nil {
+		l.SetAuthenticatedGlobalLimits(l.authenticatedGlobal.E)
+	}
+
+	return l, nil
+}
@@ -0,0 +1,22 @@
+package limiter_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+func TestValidate(t *testing.T) {
+	_, err := limiter.New(&limiter.ExpirableOptions{DefaultExpirationTTL: time.Minute, ExpireJobInterval: 5}).
+		SetGlobalLimits(-1).
+		SetPluggableLimiter([]limiter.ExpirableOptions{
+			{DefaultExpirationTTL: time.Second, ExpireJobInterval: 1, Suffix: "burst"},
+			{DefaultExpirationTTL: time.Second, ExpireJobInterval: 2, Suffix: "burst"},
+		}).Build()
+	if err == nil || !strings.Contains(err.Error(), "global limit must be positive") ||
+		!strings.Contains(err.Error(), `suffix "burst" is duplicate`) {
+		t.Fatalf("Invalid limiter is built: %v", err)
+	}
+}
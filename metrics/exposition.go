@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Metric names, prefixed by the namespace
+	decisionsName     = "goratelimit_decisions"
+	storeDurationName = "goratelimit_store_call_duration_seconds"
+
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Publish exposes snapshot of the metrics as expvar variable of the name,
+// expvar panics if the name is already published
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return c.Snapshot() }))
+}
+
+// Snapshot of the metrics, e.g. for expvar
+//
+//	{"decisions": [{"policy": "api", "tier": "request", "outcome": "allowed", "count": 1}],
+//	 "store_calls": [{"policy": "api", "tier": "request", "result": "ok", "count": 1, "sum": 0.001, "buckets": {"0.001": 1}}]}
+func (c *Collector) Snapshot() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	decisions := make([]map[string]interface{}, 0, len(c.decisions))
+	for _, labels := range c.sortedDecisions() {
+		decisions = append(decisions, map[string]interface{}{
+			"policy":  labels.Policy,
+			"tier":    labels.Tier,
+			"outcome": labels.Outcome,
+			"count":   c.decisions[labels],
+		})
+	}
+
+	storeCalls := make([]map[string]interface{}, 0, len(c.histograms))
+	for _, labels := range c.sortedHistograms() {
+		h := c.histograms[labels]
+		buckets := make(map[string]uint64, len(c.buckets))
+		for i, upper := range c.buckets {
+			buckets[formatFloat(upper)] = h.counts[i]
+		}
+		storeCalls = append(storeCalls, map[string]interface{}{
+			"policy":  labels.Policy,
+			"tier":    labels.Tier,
+			"result":  labels.Result,
+			"count":   h.count,
+			"sum":     h.sum,
+			"buckets": buckets,
+		})
+	}
+
+	return map[string]interface{}{
+		"decisions":   decisions,
+		"store_calls": storeCalls,
+	}
+}
+
+// ServeHTTP writes the metrics in OpenMetrics text format if accepted by the
+// client, Prometheus text format otherwise
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	var buf bytes.Buffer
+	c.WriteText(&buf, openMetrics)
+
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypeText)
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+// WriteText writes the metrics in Prometheus text format, or OpenMetrics text format
+func (c *Collector) WriteText(buf *bytes.Buffer, openMetrics bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// OpenMetrics names counter families without the _total suffix of the samples
+	family := decisionsName + "_total"
+	if openMetrics {
+		family = decisionsName
+	}
+	fmt.Fprintf(buf, "# HELP %s Decisions of the limiters per policy, tier & outcome.\n", family)
+	fmt.Fprintf(buf, "# TYPE %s counter\n", family)
+	for _, labels := range c.sortedDecisions() {
+		fmt.Fprintf(buf, "%s_total{policy=%s,tier=%s,outcome=%s} %d\n", decisionsName,
+			quote(labels.Policy), quote(labels.Tier), quote(labels.Outcome), c.decisions[labels])
+	}
+
+	fmt.Fprintf(buf, "# HELP %s Latency of the store calls per policy, tier & result.\n", storeDurationName)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", storeDurationName)
+	for _, labels := range c.sortedHistograms() {
+		h := c.histograms[labels]
+		common := fmt.Sprintf("policy=%s,tier=%s,result=%s", quote(labels.Policy), quote(labels.Tier), quote(labels.Result))
+		for i, upper := range c.buckets {
+			fmt.Fprintf(buf, "%s_bucket{%s,le=%s} %d\n", storeDurationName, common, quote(formatFloat(upper)), h.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", storeDurationName, common, h.count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", storeDurationName, common, formatFloat(h.sum))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", storeDurationName, common, h.count)
+	}
+
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+}
+
+// sortedDecisions returns labels of the decision counters in stable order, mu must be held
+func (c *Collector) sortedDecisions() []decisionLabels {
+	labels := make([]decisionLabels, 0, len(c.decisions))
+	for l := range c.decisions {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		if a.Tier != b.Tier {
+			return a.Tier < b.Tier
+		}
+		return a.Outcome < b.Outcome
+	})
+	return labels
+}
+
+// sortedHistograms returns labels of the latency histograms in stable order, mu must be held
+func (c *Collector) sortedHistograms() []storeLabels {
+	labels := make([]storeLabels, 0, len(c.histograms))
+	for l := range c.histograms {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		if a.Tier != b.Tier {
+			return a.Tier < b.Tier
+		}
+		return a.Result < b.Result
+	})
+	return labels
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
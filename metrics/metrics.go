@@ -0,0 +1,163 @@
+// Package metrics records decisions of the limiters & latency of the store calls,
+// exposed through expvar & an http.Handler emitting OpenMetrics/Prometheus text format.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+)
+
+// Outcomes of the decisions
+const (
+	OutcomeAllowed  = "allowed"
+	OutcomeRejected = "rejected"
+	OutcomeSkipped  = "skipped"
+	OutcomeErrored  = "errored"
+	// Allowed in shadow mode, would have been rejected
+	OutcomeShadowRejected = "shadow_rejected"
+)
+
+// Results of the store calls
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// DefaultBuckets are upper bounds in seconds of store call latency histograms
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// Collector records decisions & store call latencies of the instrumented limiters,
+// it's safe for concurrent use
+type Collector struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	decisions  map[decisionLabels]uint64
+	histograms map[storeLabels]*histogram
+}
+
+type decisionLabels struct {
+	Policy, Tier, Outcome string
+}
+
+type storeLabels struct {
+	Policy, Tier, Result string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewCollector with the bucket upper bounds of latency histograms in seconds,
+// DefaultBuckets are used if none are passed
+func NewCollector(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	return &Collector{
+		buckets:    buckets,
+		decisions:  map[decisionLabels]uint64{},
+		histograms: map[storeLabels]*histogram{},
+	}
+}
+
+// Instrument adds observer & store hook recording the limiter metrics under the
+// policy name of the limiter, so it should be invoked after SetName
+func (c *Collector) Instrument(lmt *limiter.Limiter) *limiter.Limiter {
+	policy := lmt.GetName()
+	return lmt.AddObserver(c.Observer(policy)).AddStoreHook(c.StoreHook(policy))
+}
+
+// Observer recording decisions of the policy
+func (c *Collector) Observer(policy string) limiter.Observer {
+	return limiter.ObserverFuncs{
+		Allow: func(r *http.Request, keys *limiter.LimiterKeys, lmtCtx limiter.Context) {
+			if shadowTier, ok := lmtCtx.ShadowTier(); ok {
+				c.ObserveDecision(policy, shadowTier.Tier, OutcomeShadowRejected)
+				return
+			}
+			c.ObserveDecision(policy, lmtCtx.Tier, OutcomeAllowed)
+		},
+		Reject: func(r *http.Request, keys *limiter.LimiterKeys, lmtCtx limiter.Context) {
+			c.ObserveDecision(policy, lmtCtx.Tier, OutcomeRejected)
+		},
+		Error: func(r *http.Request, keys *limiter.LimiterKeys, err error) {
+			var storeErr *limiter.StoreError
+			tier := ""
+			if errors.As(err, &storeErr) {
+				tier = storeErr.Tier
+			}
+			c.ObserveDecision(policy, tier, OutcomeErrored)
+		},
+		Skip: func(r *http.Request) {
+			c.ObserveDecision(policy, "", OutcomeSkipped)
+		},
+	}
+}
+
+// StoreHook recording latency of the store calls of the policy
+func (c *Collector) StoreHook(policy string) limiter.StoreHook {
+	return func(tier string, duration time.Duration, err error) {
+		result := ResultOK
+		if err != nil {
+			result = ResultError
+		}
+		c.ObserveStoreCall(policy, tier, result, duration)
+	}
+}
+
+// ObserveDecision increments the decision counter
+func (c *Collector) ObserveDecision(policy, tier, outcome string) {
+	c.mu.Lock()
+	c.decisions[decisionLabels{Policy: policy, Tier: tier, Outcome: outcome}]++
+	c.mu.Unlock()
+}
+
+// ObserveStoreCall records duration of the store call on the latency histogram
+func (c *Collector) ObserveStoreCall(policy, tier, result string, duration time.Duration) {
+	seconds := duration.Seconds()
+	labels := storeLabels{Policy: policy, Tier: tier, Result: result}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.histograms[labels] = h
+	}
+	for i, upper := range c.buckets {
+		if seconds <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Decisions returns the decision count of the labels
+func (c *Collector) Decisions(policy, tier, outcome string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.decisions[decisionLabels{Policy: policy, Tier: tier, Outcome: outcome}]
+}
+
+// StoreCalls returns the number of store calls of the labels
+func (c *Collector) StoreCalls(policy, tier, result string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h, ok := c.histograms[storeLabels{Policy: policy, Tier: tier, Result: result}]; ok {
+		return h.count
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package metrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/limiter"
+	"github.com/alter123/go-ratelimit/metrics"
+)
+
+func TestCollector(t *testing.T) {
+	collector := metrics.NewCollector()
+	observer := collector.Observer("metered")
+	r := httptest.NewRequest("GET", "/metered", nil)
+
+	observer.OnAllow(r, nil, limiter.Context{Tier: limiter.TierRequest})
+	observer.OnReject(r, nil, limiter.Context{Tier: limiter.TierRequest, Reached: true})
+	observer.OnSkip(r)
+	observer.OnError(r, nil, &limiter.StoreError{Tier: limiter.TierGlobal, Err: context.DeadlineExceeded})
+	observer.OnAllow(r, nil, limiter.Context{Tier: limiter.TierPluggable, Reached: true,
+		Tiers: []limiter.TierContext{{Tier: limiter.TierPluggable, Reached: true}}}.Shadowed())
+
+	for _, tc := range []struct {
+		tier, outcome string
+	}{
+		{limiter.TierRequest, metrics.OutcomeAllowed},
+		{limiter.TierRequest, metrics.OutcomeRejected},
+		{"", metrics.OutcomeSkipped},
+		{limiter.TierGlobal, metrics.OutcomeErrored},
+		{limiter.TierPluggable, metrics.OutcomeShadowRejected},
+	} {
+		if collector.Decisions("metered", tc.tier, tc.outcome) != 1 {
+			t.Fatalf("Decision %s of %q tier is not recorded: %v", tc.outcome, tc.tier, collector.Snapshot())
+		}
+	}
+
+	hook := collector.StoreHook("metered")
+	hook(limiter.TierRequest, time.Millisecond, nil)
+	hook(limiter.TierRequest, 2*time.Millisecond, nil)
+	hook(limiter.TierGlobal, time.Second, context.DeadlineExceeded)
+	if collector.StoreCalls("metered", limiter.TierRequest, metrics.ResultOK) != 2 ||
+		collector.StoreCalls("metered", limiter.TierGlobal, metrics.ResultError) != 1 ||
+		collector.StoreCalls("metered", limiter.TierGlobal, metrics.ResultOK) != 0 {
+		t.Fatalf("Store calls are not recorded: %v", collector.Snapshot())
+	}
+}
+
+func TestExposition(t *testing.T) {
+	collector := metrics.NewCollector(.01, .001)
+	collector.ObserveDecision("metered", limiter.TierRequest, metrics.OutcomeRejected)
+	collector.ObserveStoreCall("metered", limiter.TierGlobal, metrics.ResultOK, 5*time.Millisecond)
+	collector.ObserveStoreCall("metered", limiter.TierGlobal, metrics.ResultOK, 50*time.Millisecond)
+
+	for accept, tc := range map[string]struct {
+		contentType string
+		expected    []string
+	}{
+		"": {
+			contentType: "text/plain",
+			expected:    []string{"# TYPE goratelimit_decisions_total counter"},
+		},
+		"application/openmetrics-text": {
+			contentType: "application/openmetrics-text",
+			expected:    []string{"# TYPE goratelimit_decisions counter", "# EOF"},
+		},
+	} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		collector.ServeHTTP(w, r)
+
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), tc.contentType) {
+			t.Fatalf("Content type of %q is invalid: %s", accept, w.Header().Get("Content-Type"))
+		}
+		// Buckets are sorted & cumulative
+		body := w.Body.String()
+		for _, expected := range append(tc.expected,
+			`goratelimit_decisions_total{policy="metered",tier="request",outcome="rejected"} 1`,
+			`goratelimit_store_call_duration_seconds_bucket{policy="metered",tier="global",result="ok",le="0.001"} 0`,
+			`goratelimit_store_call_duration_seconds_bucket{policy="metered",tier="global",result="ok",le="0.01"} 1`,
+			`goratelimit_store_call_duration_seconds_bucket{policy="metered",tier="global",result="ok",le="+Inf"} 2`,
+			`goratelimit_store_call_duration_seconds_count{policy="metered",tier="global",result="ok"} 2`,
+		) {
+			if !strings.Contains(body, expected) {
+				t.Fatalf("Metrics of %q don't contain %s: %s", accept, expected, body)
+			}
+		}
+	}
+
+	collector.Publish("goratelimit_test")
+	var snapshot struct {
+		Decisions []struct {
+			Policy, Tier, Outcome string
+			Count                 uint64
+		} `json:"decisions"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("goratelimit_test").String()), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Decisions) != 1 || snapshot.Decisions[0].Outcome != metrics.OutcomeRejected ||
+		snapshot.Decisions[0].Count != 1 {
+		t.Fatalf("Metrics are not published: %+v", snapshot)
+	}
+}
@@ -0,0 +1,321 @@
+// Package proxyproto provides net.Listener which parses PROXY protocol v1 & v2
+// headers, so that RemoteAddr of the connection is the address of the client
+// instead of the load balancer, see https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alter123/go-ratelimit/libstring"
+)
+
+const (
+	// Maximum length of v1 header including CRLF
+	v1MaxLength = 107
+
+	// Length of v2 header preceding the addresses
+	v2HeaderLength = 16
+
+	// Default timeout to read PROXY header from the connection
+	DefaultReadHeaderTimeout = 10 * time.Second
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY protocol header")
+)
+
+// Options for PROXY protocol listener
+type Options struct {
+	// Sources trusted to send PROXY header, empty list trusts none of them.
+	// Connections from other sources are passed through untouched.
+	TrustedProxies []*net.IPNet
+
+	// Timeout to read PROXY header, defaults to DefaultReadHeaderTimeout
+	ReadHeaderTimeout time.Duration
+}
+
+// Listener wraps net.Listener to parse PROXY header of accepted connections
+type Listener struct {
+	net.Listener
+	opts Options
+}
+
+// NewListener wraps listener to parse PROXY header of accepted connections
+func NewListener(ln net.Listener, opts Options) *Listener {
+	if opts.ReadHeaderTimeout == 0 {
+		opts.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	return &Listener{Listener: ln, opts: opts}
+}
+
+// Accept waits for the next connection, PROXY header is parsed lazily upon
+// first Read or RemoteAddr call so that slow clients don't block Accept
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, l.opts), nil
+}
+
+// Conn is net.Conn with the addresses as per PROXY header
+type Conn struct {
+	net.Conn
+	opts Options
+
+	reader *bufio.Reader
+	once   sync.Once
+	err    error
+
+	// Read deadline set by the caller, restored after reading the header
+	mu           sync.Mutex
+	readDeadline time.Time
+
+	remoteAddr, localAddr net.Addr
+}
+
+// NewConn wraps conn to parse PROXY header
+func NewConn(conn net.Conn, opts Options) *Conn {
+	return &Conn{
+		Conn:   conn,
+		opts:   opts,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns address of the client as per PROXY header
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns destination address as per PROXY header
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline sets read & write deadlines, see net.Conn
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets read deadline, see net.Conn
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *Conn) isTrusted() bool {
+	if len(c.opts.TrustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(c.Conn.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+	return libstring.IsTrustedProxy(host, c.opts.TrustedProxies)
+}
+
+func (c *Conn) readHeader() {
+	if !c.isTrusted() {
+		return
+	}
+
+	if c.opts.ReadHeaderTimeout > 0 {
+		c.mu.Lock()
+		readDeadline := c.readDeadline
+		c.mu.Unlock()
+
+		// Header timeout doesn't extend the deadline set by the caller
+		deadline := time.Now().Add(c.opts.ReadHeaderTimeout)
+		if !readDeadline.IsZero() && readDeadline.Before(deadline) {
+			deadline = readDeadline
+		}
+		if err := c.Conn.SetReadDeadline(deadline); err == nil {
+			defer c.restoreReadDeadline()
+		}
+	}
+
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		// Connection without any data doesn't carry header
+		if err != io.EOF {
+			c.err = err
+		}
+		return
+	}
+
+	switch first[0] {
+	case v1Signature[0]:
+		c.err = c.readV1Header()
+	case v2Signature[0]:
+		c.err = c.readV2Header()
+	}
+}
+
+// restoreReadDeadline restores the deadline set by the caller, if any
+func (c *Conn) restoreReadDeadline() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Conn.SetReadDeadline(c.readDeadline)
+}
+
+// hasSignature peeks the connection for the signature, without consuming it
+func (c *Conn) hasSignature(signature []byte) (bool, error) {
+	for i := 1; i <= len(signature); i++ {
+		b, err := c.reader.Peek(i)
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+		if b[i-1] != signature[i-1] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// readV1Header parses human readable header, e.g. "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func (c *Conn) readV1Header() error {
+	if ok, err := c.hasSignature(v1Signature); !ok || err != nil {
+		return err
+	}
+
+	var line []byte
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return fmt.Errorf("%w: v1 header exceeds %d bytes", ErrInvalidHeader, v1MaxLength)
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return fmt.Errorf("%w: v1 header is not terminated by CRLF", ErrInvalidHeader)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		// Addresses of the connection are retained
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("%w: malformed v1 header %q", ErrInvalidHeader, line)
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, srcErr := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, dstErr := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || srcErr != nil || dstErr != nil {
+		return fmt.Errorf("%w: malformed v1 addresses %q", ErrInvalidHeader, line)
+	}
+
+	c.remoteAddr = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	c.localAddr = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+	return nil
+}
+
+// readV2Header parses binary header
+func (c *Conn) readV2Header() error {
+	if ok, err := c.hasSignature(v2Signature); !ok || err != nil {
+		return err
+	}
+
+	header := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0F
+	family, transport := header[13]>>4, header[13]&0x0F
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	if version != 2 {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, version)
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL command, e.g. health checks of the proxy, addresses are retained
+		return nil
+	case 0x1:
+	default:
+		return fmt.Errorf("%w: unsupported command %d", ErrInvalidHeader, command)
+	}
+
+	// Only TCP & UDP over IPv4/IPv6 carry addresses, TLVs following them are skipped
+	var ipLength int
+	switch family {
+	case 0x1:
+		ipLength = net.IPv4len
+	case 0x2:
+		ipLength = net.IPv6len
+	default:
+		return nil
+	}
+	if transport != 0x1 && transport != 0x2 {
+		return nil
+	}
+
+	if len(payload) < 2*ipLength+4 {
+		return fmt.Errorf("%w: v2 addresses are truncated", ErrInvalidHeader)
+	}
+
+	srcIP := net.IP(payload[:ipLength])
+	dstIP := net.IP(payload[ipLength : 2*ipLength])
+	srcPort := int(binary.BigEndian.Uint16(payload[2*ipLength:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*ipLength+2:]))
+
+	if transport == 0x2 {
+		c.remoteAddr = &net.UDPAddr{IP: srcIP, Port: srcPort}
+		c.localAddr = &net.UDPAddr{IP: dstIP, Port: dstPort}
+		return nil
+	}
+	c.remoteAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	c.localAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return nil
+}
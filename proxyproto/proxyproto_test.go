@@ -0,0 +1,137 @@
+package proxyproto_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alter123/go-ratelimit/libstring"
+	"github.com/alter123/go-ratelimit/proxyproto"
+)
+
+// acceptWith dials listener, writes payload & returns the accepted connection
+func acceptWith(t *testing.T, opts proxyproto.Options, payload []byte) net.Conn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if _, err := client.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := proxyproto.NewListener(ln, opts).Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// loopback trusts the test client to send PROXY header
+func loopback(t *testing.T) proxyproto.Options {
+	trustedProxies, err := libstring.ParseCIDRs("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxyproto.Options{TrustedProxies: trustedProxies}
+}
+
+func readLine(t *testing.T, conn net.Conn) string {
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func TestV1Header(t *testing.T) {
+	conn := acceptWith(t, loopback(t),
+		[]byte("PROXY TCP4 203.0.113.9 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n"))
+
+	if addr := conn.RemoteAddr().String(); addr != "203.0.113.9:56324" {
+		t.Fatalf("Remote addr is not client address: %q", addr)
+	}
+	if line := readLine(t, conn); line != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("Header is not consumed: %q", line)
+	}
+}
+
+func TestV2Header(t *testing.T) {
+	payload := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	payload = append(payload, 0x21, 0x21, 0, 36)
+	payload = append(payload, net.ParseIP("2001:db8::9")...)
+	payload = append(payload, net.ParseIP("2001:db8::1")...)
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports, 56324)
+	binary.BigEndian.PutUint16(ports[2:], 443)
+	payload = append(payload, ports...)
+	payload = append(payload, "GET / HTTP/1.1\r\n"...)
+
+	conn := acceptWith(t, loopback(t), payload)
+	if addr := conn.RemoteAddr().String(); addr != "[2001:db8::9]:56324" {
+		t.Fatalf("Remote addr is not client address: %q", addr)
+	}
+	if line := readLine(t, conn); line != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("Header is not consumed: %q", line)
+	}
+}
+
+func TestUntrustedSource(t *testing.T) {
+	trustedProxies, err := libstring.ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := "PROXY TCP4 203.0.113.9 192.0.2.2 56324 443\r\n"
+	conn := acceptWith(t, proxyproto.Options{TrustedProxies: trustedProxies}, []byte(header))
+
+	if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+		t.Fatalf("Remote addr is overridden by untrusted source: %q", host)
+	}
+	if line := readLine(t, conn); line != header {
+		t.Fatalf("Header from untrusted source is consumed: %q", line)
+	}
+}
+
+func TestWithoutTrustedProxies(t *testing.T) {
+	header := "PROXY TCP4 203.0.113.9 192.0.2.2 56324 443\r\n"
+	conn := acceptWith(t, proxyproto.Options{}, []byte(header))
+
+	// Header is ignored unless the source is trusted explicitly
+	if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+		t.Fatalf("Remote addr is overridden without trusted proxies: %q", host)
+	}
+	if line := readLine(t, conn); line != header {
+		t.Fatalf("Header is consumed without trusted proxies: %q", line)
+	}
+}
+
+func TestReadDeadlineIsRetained(t *testing.T) {
+	conn := acceptWith(t, loopback(t),
+		[]byte("PROXY TCP4 203.0.113.9 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n"))
+
+	if err := conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	if line, err := reader.ReadString('\n'); err != nil || line != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("Header is not consumed: %q, %v", line, err)
+	}
+
+	// Deadline of the caller still applies after reading the header
+	var netErr net.Error
+	if _, err := reader.ReadByte(); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Read deadline is not retained: %v", err)
+	}
+}